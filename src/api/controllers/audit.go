@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AuditController struct {
+	Service                services.BaseAuditService
+	SchemaValidator        *validator.Validate
+	PaginationDefaultLimit int64
+}
+
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, base.NewQueryParamError(name, err)
+	}
+	return &parsed, nil
+}
+
+// GetAuditEvents Get audit events godoc
+// @Summary      Get audit events
+// @Description  This method returns audit events of mutating operations
+// @Description  ordered by time. Time range bounds use RFC 3339 format
+// @Tags         Audit
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 _ 	  query     api.AuditQueryParameters false "Filters and pagination parameters"
+// @Success      200  {object}  api.GetAuditEventsResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/audit [get]
+func (controller AuditController) GetAuditEvents(c *gin.Context) {
+	api.Logger(c).Info("Requested audit events")
+
+	queryParams := api.AuditQueryParameters{
+		Actor:     c.Query(base.ActorQueryParam),
+		Target:    c.Query(base.TargetQueryParam),
+		Action:    c.Query(base.ActionQueryParam),
+		PageToken: c.Query(base.PageTokenQueryParam),
+	}
+
+	var err error
+	if queryParams.From, err = parseTimeQuery(c, base.FromQueryParam); err != nil {
+		c.Error(err)
+		return
+	}
+	if queryParams.To, err = parseTimeQuery(c, base.ToQueryParam); err != nil {
+		c.Error(err)
+		return
+	}
+	if queryParams.PageToken != "" {
+		if _, err = strconv.ParseInt(queryParams.PageToken, 10, 64); err != nil {
+			c.Error(base.NewQueryParamError(base.PageTokenQueryParam, err))
+			return
+		}
+	}
+	val := strconv.FormatInt(controller.PaginationDefaultLimit, 10)
+	queryParams.Limit, err = strconv.ParseInt(
+		c.DefaultQuery(base.LimitQueryParam, val), 10, 64)
+	if err != nil {
+		c.Error(base.NewQueryParamError(base.LimitQueryParam, err))
+		return
+	}
+	if err = controller.SchemaValidator.Struct(queryParams); err != nil {
+		c.Error(base.WrapValidationErrors(err))
+		return
+	}
+
+	response, err := controller.Service.Query(&queryParams)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
@@ -1,15 +1,123 @@
 package controllers
 
 import (
+	"access-backend/api"
 	"access-backend/api/services"
 	"access-backend/base"
+	"access-backend/signing"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type AuthController struct {
-	AuthService services.BaseAuthorizationService
+	AuthService      services.BaseAuthorizationService
+	LockoutConfig    *base.LockoutConfig
+	LockoutService   services.BaseLockoutService
+	SignatureService services.BaseSignatureService
+	TokenService     services.BaseTokenService
+}
+
+// lockoutKeys returns failures counter keys of client IP and credential.
+// Credential is hashed, so store does not contain secrets.
+func lockoutKeys(clientIp string, credential string) (string, string) {
+	hash := sha256.Sum256([]byte(credential))
+	return "ip:" + clientIp, "token:" + hex.EncodeToString(hash[:16])
+}
+
+// lockoutPrefixLength is length of unverified bearer token prefix, which
+// identifies its failures counter.
+const lockoutPrefixLength = 8
+
+// lockoutCredential returns credential identity of bearer token. Exchanged
+// tokens with valid signature are identified by token id, other tokens by
+// fixed-length prefix, so guesses sharing it share failures counter.
+func (controller AuthController) lockoutCredential(token string) string {
+	if controller.TokenService != nil &&
+		strings.HasPrefix(token, services.ExchangeTokenPrefix) {
+		if tokenId := controller.TokenService.TokenId(token); tokenId != "" {
+			return "jti:" + tokenId
+		}
+	}
+	return "bearer:" + token[:min(len(token), lockoutPrefixLength)]
+}
+
+func tooManyAttempts(context *gin.Context, retryAfter time.Duration) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	context.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	context.Error(base.ServiceError{
+		Summary: "Too many failed authorization attempts",
+		Detail:  "Retry after " + strconv.FormatInt(seconds, 10) + " seconds",
+		Status:  http.StatusTooManyRequests,
+	})
+	context.Abort()
+}
+
+func logLockoutError(context *gin.Context, err error) {
+	api.Logger(context).WithFields(logrus.Fields{
+		"error": err.Error(),
+	}).Error("Error accessing authorization attempts store")
+}
+
+func (controller AuthController) authenticate(
+	context *gin.Context,
+	credential string,
+	parse func() (*api.AdminUser, error),
+) (*api.AdminUser, bool) {
+	if controller.LockoutService == nil {
+		user, err := parse()
+		if err != nil {
+			context.Error(err)
+			context.Abort()
+			return nil, false
+		}
+		return user, true
+	}
+
+	ipKey, credentialKey := lockoutKeys(context.ClientIP(), credential)
+	retryAfter, err := controller.LockoutService.Check(ipKey, credentialKey)
+	if err != nil {
+		logLockoutError(context, err)
+		if controller.LockoutConfig != nil && controller.LockoutConfig.FailClosed {
+			context.Error(base.ServiceError{
+				Summary: "Authorization attempts store unavailable",
+				Status:  http.StatusServiceUnavailable,
+			})
+			context.Abort()
+			return nil, false
+		}
+	} else if retryAfter > 0 {
+		tooManyAttempts(context, retryAfter)
+		return nil, false
+	}
+
+	user, err := parse()
+	if err != nil {
+		retryAfter, lockoutErr := controller.LockoutService.RegisterFailure(
+			context.ClientIP(), ipKey, credentialKey,
+		)
+		if lockoutErr != nil {
+			logLockoutError(context, lockoutErr)
+		} else if retryAfter > 0 {
+			tooManyAttempts(context, retryAfter)
+			return nil, false
+		}
+		context.Error(err)
+		context.Abort()
+		return nil, false
+	}
+	// Client IP counter is not reset, otherwise one valid credential would
+	// let caller keep guessing others
+	if err = controller.LockoutService.RegisterSuccess(credentialKey); err != nil {
+		logLockoutError(context, err)
+	}
+	return user, true
 }
 
 func (controller AuthController) Authorize(context *gin.Context) {
@@ -23,15 +131,35 @@ func (controller AuthController) Authorize(context *gin.Context) {
 		return
 	}
 	if strings.HasPrefix(tokenString, "Bearer ") {
-		user, err := controller.AuthService.ParseToken(
-			tokenString[7:],
+		token := tokenString[7:]
+		user, ok := controller.authenticate(
+			context,
+			controller.lockoutCredential(token),
+			func() (*api.AdminUser, error) {
+				if controller.TokenService != nil &&
+					strings.HasPrefix(token, services.ExchangeTokenPrefix) {
+					return controller.TokenService.ParseToken(token)
+				}
+				return controller.AuthService.ParseToken(token)
+			},
 		)
-		if err != nil {
-			context.Error(err)
-			context.Abort()
+		if !ok {
+			return
+		}
+		context.Set(base.AuthContextKey, user)
+		context.Next()
+	} else if strings.HasPrefix(tokenString, signing.Scheme+" ") &&
+		controller.SignatureService != nil {
+		keyId, _, _ := signing.ParseAuthorization(tokenString)
+		user, ok := controller.authenticate(
+			context, "key:"+keyId, func() (*api.AdminUser, error) {
+				return controller.SignatureService.VerifyRequest(context.Request)
+			},
+		)
+		if !ok {
 			return
 		}
-		context.Set("auth", user)
+		context.Set(base.AuthContextKey, user)
 		context.Next()
 	} else {
 		context.Error(base.ServiceError{
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLockoutCredential(t *testing.T) {
+	revocations, _ := services.NewRevocationList("")
+	tokenService := &services.TokenService{
+		ExchangeConfig: &base.TokenExchangeConfig{
+			Secret:     "Qm8sLw3Kd9Zx2Vb7Nc4Rt6Yh1Jp5Gf0Ae",
+			DefaultTtl: time.Minute,
+			MaxTtl:     time.Hour,
+		},
+		Revocations: revocations,
+	}
+	controller := AuthController{TokenService: tokenService}
+	issue := func() *api.TokenResponse {
+		response, err := tokenService.IssueToken(
+			&api.AdminUser{
+				Username:    "ci",
+				Permissions: []base.Permission{base.ReadUsersPermission},
+			},
+			&api.TokenRequest{
+				Scopes: []base.Permission{base.ReadUsersPermission},
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	first, second := issue(), issue()
+
+	tests := []struct {
+		name     string
+		token    string
+		expected string
+	}{
+		{
+			name:     "exchanged token",
+			token:    first.Token,
+			expected: "jti:" + first.TokenId,
+		},
+		{
+			name:     "other exchanged token",
+			token:    second.Token,
+			expected: "jti:" + second.TokenId,
+		},
+		{
+			name:     "forged exchanged token",
+			token:    first.Token + "x",
+			expected: "bearer:" + first.Token[:lockoutPrefixLength],
+		},
+		{name: "static token", token: "static", expected: "bearer:static"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := controller.lockoutCredential(test.token)
+			if actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLockoutKeys(t *testing.T) {
+	controller := AuthController{}
+	_, first := lockoutKeys(
+		"10.0.0.1", controller.lockoutCredential("sksjdhdh-guess-1"),
+	)
+	_, second := lockoutKeys(
+		"10.0.0.1", controller.lockoutCredential("sksjdhdh-guess-2"),
+	)
+	if first != second {
+		t.Error("guesses with the same prefix have different lockout keys")
+	}
+	_, other := lockoutKeys(
+		"10.0.0.1", controller.lockoutCredential("Jd8sn2Kd-guess-1"),
+	)
+	if other == first {
+		t.Error("guesses with different prefixes share lockout key")
+	}
+	ipKey, key := lockoutKeys("10.0.0.1", "bearer:secret")
+	if ipKey != "ip:10.0.0.1" {
+		t.Errorf("unexpected IP key %q", ipKey)
+	}
+	if _, again := lockoutKeys("10.0.0.2", "bearer:secret"); again != key {
+		t.Error("credential key depends on client IP")
+	}
+}
+
+// unavailableLockoutService fails like unreachable attempts store.
+type unavailableLockoutService struct {
+	services.BaseLockoutService
+}
+
+func (unavailableLockoutService) Check(...string) (time.Duration, error) {
+	return 0, errors.New("store is unavailable")
+}
+
+func (unavailableLockoutService) RegisterSuccess(...string) error {
+	return errors.New("store is unavailable")
+}
+
+func TestLockoutStoreUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, failClosed := range []bool{false, true} {
+		controller := AuthController{
+			LockoutConfig:  &base.LockoutConfig{FailClosed: failClosed},
+			LockoutService: unavailableLockoutService{},
+		}
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+
+		_, ok := controller.authenticate(
+			c, "bearer:secret", func() (*api.AdminUser, error) {
+				return &api.AdminUser{Username: "admin"}, nil
+			},
+		)
+		if ok == failClosed {
+			t.Errorf("failClosed %v: expected authorized %v", failClosed, !failClosed)
+		}
+		if failClosed &&
+			base.ErrorStatus(c.Errors.Last().Err) != http.StatusServiceUnavailable {
+			t.Errorf("expected status 503, got %v", c.Errors)
+		}
+	}
+}
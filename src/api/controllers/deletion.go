@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type DeletionController struct {
+	Service      services.BaseDeletionService
+	AuditService services.BaseAuditService
+}
+
+// service returns deletion service, which starts sagas in request span
+// with request id.
+func (controller DeletionController) service(
+	c *gin.Context,
+) services.BaseDeletionService {
+	return controller.Service.WithRequestContext(c.Request.Context())
+}
+
+// GetDeletion Get user deletion status godoc
+// @Summary      Get user deletion status
+// @Description  This method returns state of user deletion saga with
+// @Description  results of downstream deletion hooks
+// @Tags         Users
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 user_id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
+// @Success      200  {object}  api.DeletionStatusResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/users/{user_id}/deletion [get]
+func (controller DeletionController) GetDeletion(c *gin.Context) {
+	api.Logger(c).Info("Requested user deletion status")
+
+	userId := c.Param(base.UserIdPathParam)
+	if userId == "" {
+		c.Error(base.NewPathParamRequiredError(base.UserIdPathParam))
+		return
+	}
+
+	deletion, err := controller.Service.GetStatus(userId)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, deletion)
+}
+
+func (controller DeletionController) restart(
+	c *gin.Context,
+	action string,
+	restart func(userId string) (*api.DeletionStatusResponse, error),
+) {
+	userId := c.Param(base.UserIdPathParam)
+	if userId == "" {
+		c.Error(base.NewPathParamRequiredError(base.UserIdPathParam))
+		return
+	}
+
+	deletion, err := restart(userId)
+	if controller.AuditService != nil {
+		event := api.AuditEvent{
+			Action:       action,
+			TargetUserId: userId,
+			RequestId:    api.RequestId(c),
+			ClientIp:     c.ClientIP(),
+			Status:       http.StatusAccepted,
+		}
+		if user := api.CurrentUser(c); user != nil {
+			event.Actor = user.Username
+		}
+		if err != nil {
+			event.Status = base.ErrorStatus(err)
+		}
+		controller.AuditService.Record(&event, nil, nil)
+	}
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusAccepted, deletion)
+}
+
+// ResumeDeletion Resume user deletion godoc
+// @Summary      Resume user deletion
+// @Description  This method retries failed steps of user deletion saga
+// @Tags         Users
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 user_id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
+// @Success      202  {object}  api.DeletionStatusResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      409  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/users/{user_id}/deletion/resume [post]
+func (controller DeletionController) ResumeDeletion(c *gin.Context) {
+	api.Logger(c).Info("Requested resuming user deletion")
+
+	controller.restart(c, base.ResumeDeletionAction, controller.service(c).Resume)
+}
+
+// ForceDeletion Force user deletion godoc
+// @Summary      Force user deletion
+// @Description  This method skips unfinished downstream steps of user
+// @Description  deletion saga and deletes user from Kratos
+// @Tags         Users
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 user_id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
+// @Success      202  {object}  api.DeletionStatusResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      409  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/users/{user_id}/deletion/force [post]
+func (controller DeletionController) ForceDeletion(c *gin.Context) {
+	api.Logger(c).Info("Requested forcing user deletion")
+
+	controller.restart(c, base.ForceDeletionAction, controller.service(c).Force)
+}
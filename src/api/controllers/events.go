@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type EventStreamController struct {
+	Service           services.BaseEventStreamService
+	HeartbeatInterval time.Duration
+	// Streams are finished when shutdown begins, so they do not hold
+	// server shutdown until timeout
+	Lifecycle *services.LifecycleService
+}
+
+func writeStreamEvent(c *gin.Context, event *services.StreamEvent) error {
+	eventType, data := base.StreamResetEvent, []byte("{}")
+	if !event.Reset {
+		var err error
+		if data, err = json.Marshal(event.Event); err != nil {
+			return err
+		}
+		eventType = event.Event.Type
+	}
+	_, err := fmt.Fprintf(
+		c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.Id, eventType, data,
+	)
+	return err
+}
+
+// StreamEvents Stream user events godoc
+// @Summary      Stream user events
+// @Description  This method streams user.created, user.updated,
+// @Description  user.deactivated, user.deleted and session.revoked events
+// @Description  as Server-Sent Events. Stream is resumed after the event
+// @Description  from 'Last-Event-ID' header, if it is still buffered.
+// @Description  Otherwise, e.g. after service restart, stream.reset event
+// @Description  is sent and stream starts from new events, so client must
+// @Description  reload users.
+// @Description  Heartbeat comments are sent to keep connection alive
+// @Tags         Events
+// @Security     User
+// @Produce      text/event-stream
+// @Param        Last-Event-ID header string false "Id of the last received event"
+// @Success      200  {object}  api.UserEvent
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/events/stream [get]
+func (controller EventStreamController) StreamEvents(c *gin.Context) {
+	api.Logger(c).Info("Requested events stream")
+
+	backlog, events, unsubscribe := controller.Service.Subscribe(
+		c.GetHeader(base.LastEventIdHeader),
+	)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, event := range backlog {
+		if err := writeStreamEvent(c, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	var draining <-chan struct{}
+	if controller.Lifecycle != nil {
+		draining = controller.Lifecycle.Draining()
+	}
+	heartbeat := time.NewTicker(controller.HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-draining:
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeStreamEvent(c, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
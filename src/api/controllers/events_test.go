@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"context"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamEventsReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := services.NewEventStreamService(&base.EventStreamConfig{
+		BufferSize:       10,
+		ClientBufferSize: 10,
+	})
+	service.HandleEvent(&api.UserEvent{Type: base.UserCreatedEvent, UserId: "42"})
+	controller := EventStreamController{
+		Service:           service,
+		HeartbeatInterval: time.Hour,
+	}
+
+	tests := []struct {
+		name        string
+		lastEventId string
+		expected    string
+	}{
+		{name: "new client"},
+		{
+			name:        "previous run",
+			lastEventId: "1700000000000-1",
+			expected:    "event: " + base.StreamResetEvent + "\ndata: {}\n\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(
+				context.Background(), 50*time.Millisecond,
+			)
+			defer cancel()
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(
+				http.MethodGet, "/events/stream", nil,
+			).WithContext(ctx)
+			if test.lastEventId != "" {
+				c.Request.Header.Set(base.LastEventIdHeader, test.lastEventId)
+			}
+
+			controller.StreamEvents(c)
+			body := recorder.Body.String()
+			if test.expected != "" && !strings.HasSuffix(body, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, body)
+			}
+			if test.expected == "" && body != "" {
+				t.Errorf("expected no events, got %q", body)
+			}
+			if strings.Contains(body, base.UserCreatedEvent) {
+				t.Errorf("event of previous run replayed: %q", body)
+			}
+		})
+	}
+}
@@ -2,27 +2,95 @@ package controllers
 
 import (
 	"access-backend/api"
+	"access-backend/api/services"
 	"access-backend/base"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
 
+type HealthController struct {
+	Lifecycle *services.LifecycleService
+	Service   services.BaseHealthService
+}
+
 // CheckHealth Service health
 // @Summary      Check service health
-// @Description  This method returns service health
+// @Description  This method returns service health. After shutdown signal
+// @Description  it returns "shutting down" status with 503 status code.
+// @Description  Use /v1/health/live and /v1/health/ready instead
 // @Tags         Health
 // @Accept       json
 // @Produce      json
 // @Success      200  {object}  api.HealthcheckResponse
 // @Failure      400  {object}  api.ErrorResponse
 // @Failure      500  {object}  api.ErrorResponse
+// @Failure      503  {object}  api.HealthcheckResponse
+// @Deprecated
 // @Router       /v1/health [get]
-func CheckHealth(c *gin.Context) {
-	base.Logger.Info("Requested healthcheck")
+func (controller HealthController) CheckHealth(c *gin.Context) {
+	api.Logger(c).Info("Requested healthcheck")
+
+	if controller.Lifecycle != nil && controller.Lifecycle.ShuttingDown() {
+		c.IndentedJSON(http.StatusServiceUnavailable, api.HealthcheckResponse{
+			Status: base.HealthStatusShuttingDown,
+		})
+		return
+	}
 
 	response := api.HealthcheckResponse{
-		Status: "ok",
+		Status: base.HealthStatusOk,
 	}
 
 	c.IndentedJSON(http.StatusOK, response)
 }
+
+// Live Service liveness
+// @Summary      Check service liveness
+// @Description  This method returns "ok" while process serves requests,
+// @Description  dependencies are not checked
+// @Tags         Health
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  api.HealthcheckResponse
+// @Router       /v1/health/live [get]
+func (controller HealthController) Live(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, api.HealthcheckResponse{
+		Status: base.HealthStatusOk,
+	})
+}
+
+// Ready Service readiness
+// @Summary      Check service readiness
+// @Description  This method checks Kratos readiness, user identity schema
+// @Description  traits and configured stores. Results are cached for
+// @Description  health.cacheTtl. Service is not ready with 503 status code,
+// @Description  if any dependency is unavailable or service is shutting down.
+// @Description  Dependency details are served by GET /health/ready of
+// @Description  operations listener, or of the main listener without base
+// @Description  path with operations token, if operations listener is disabled
+// @Tags         Health
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  api.HealthcheckResponse
+// @Failure      503  {object}  api.HealthcheckResponse
+// @Router       /v1/health/ready [get]
+func (controller HealthController) Ready(c *gin.Context) {
+	response := controller.Service.Readiness()
+	c.IndentedJSON(readinessStatus(response), api.HealthcheckResponse{
+		Status: response.Status,
+	})
+}
+
+// ReadyDetails responds readiness with status, latency and error of every
+// dependency.
+func (controller HealthController) ReadyDetails(c *gin.Context) {
+	response := controller.Service.Readiness()
+	c.IndentedJSON(readinessStatus(response), response)
+}
+
+func readinessStatus(response *api.ReadinessResponse) int {
+	if response.Status != base.HealthStatusOk {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type staticHealthService struct {
+	response api.ReadinessResponse
+}
+
+func (service staticHealthService) Readiness() *api.ReadinessResponse {
+	return &service.response
+}
+
+func TestReadyHidesDependencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	controller := HealthController{Service: staticHealthService{
+		response: api.ReadinessResponse{
+			Status: base.HealthStatusUnavailable,
+			Dependencies: map[string]api.DependencyStatus{
+				"kratos": {
+					Status: base.HealthStatusUnavailable,
+					Error:  "dial tcp 10.0.0.5:4434: connection refused",
+				},
+			},
+		},
+	}}
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		details bool
+	}{
+		{name: "public", handler: controller.Ready},
+		{name: "ops", handler: controller.ReadyDetails, details: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+
+			test.handler(c)
+			if recorder.Code != http.StatusServiceUnavailable {
+				t.Fatalf("expected status 503, got %d", recorder.Code)
+			}
+			var response map[string]any
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+			if response["status"] != base.HealthStatusUnavailable {
+				t.Errorf("unexpected response %s", recorder.Body.String())
+			}
+			if _, ok := response["dependencies"]; ok != test.details {
+				t.Errorf("unexpected response %s", recorder.Body.String())
+			}
+		})
+	}
+}
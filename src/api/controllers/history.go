@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type HistoryController struct {
+	Service      services.BaseHistoryService
+	AuditService services.BaseAuditService
+}
+
+// latestTraits returns traits of the latest recorded user version or nil.
+func (controller HistoryController) latestTraits(userId string) map[string]any {
+	history, err := controller.Service.GetHistory(userId)
+	if err != nil || len(history.List) == 0 {
+		return nil
+	}
+	return history.List[len(history.List)-1].Traits
+}
+
+func (controller HistoryController) audit(
+	c *gin.Context, actor string, userId string, err error, before map[string]any,
+) {
+	if controller.AuditService == nil {
+		return
+	}
+
+	event := api.AuditEvent{
+		Action:       base.RestoreUserAction,
+		Actor:        actor,
+		TargetUserId: userId,
+		RequestId:    api.RequestId(c),
+		ClientIp:     c.ClientIP(),
+		Status:       http.StatusOK,
+	}
+	after := before
+	if err != nil {
+		event.Status = base.ErrorStatus(err)
+	} else {
+		after = controller.latestTraits(userId)
+	}
+	controller.AuditService.Record(&event, before, after)
+}
+
+// GetUserHistory Get user history godoc
+// @Summary      Get user history
+// @Description  This method returns versions of user traits, state and
+// @Description  metadata with changes from the previous version. Versions
+// @Description  are recorded after changes made by this service, Kratos
+// @Description  hooks and reconciliation
+// @Tags         Users
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 user_id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
+// @Success      200  {object}  api.GetUserHistoryResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/users/{user_id}/history [get]
+func (controller HistoryController) GetUserHistory(c *gin.Context) {
+	api.Logger(c).Info("Requested user history")
+
+	userId := c.Param(base.UserIdPathParam)
+	if userId == "" {
+		c.Error(base.NewPathParamRequiredError(base.UserIdPathParam))
+		return
+	}
+
+	history, err := controller.Service.GetHistory(userId)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, history)
+}
+
+// RestoreUserVersion Restore user version godoc
+// @Summary      Restore user version
+// @Description  This method applies traits and metadata of history version
+// @Description  to user with Kratos UpdateIdentity. State of user is not
+// @Description  changed
+// @Tags         Users
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 user_id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
+// @Param 		 version path int true "Version" example(3)
+// @Success      200  {object}  api.UserResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/users/{user_id}/history/{version}/restore [post]
+func (controller HistoryController) RestoreUserVersion(c *gin.Context) {
+	api.Logger(c).Info("Requested restoring user version")
+
+	userId := c.Param(base.UserIdPathParam)
+	if userId == "" {
+		c.Error(base.NewPathParamRequiredError(base.UserIdPathParam))
+		return
+	}
+	version, err := strconv.ParseInt(c.Param(base.VersionPathParam), 10, 64)
+	if err != nil {
+		c.Error(base.NewPathParamError(base.VersionPathParam, err))
+		return
+	}
+
+	actor := ""
+	if user := api.CurrentUser(c); user != nil {
+		actor = user.Username
+	}
+	before := controller.latestTraits(userId)
+	user, err := controller.Service.WithRequestContext(
+		c.Request.Context(),
+	).Restore(userId, version, actor)
+	controller.audit(c, actor, userId, err, before)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, user)
+}
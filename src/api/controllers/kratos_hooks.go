@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"net/http"
+)
+
+var kratosHookActions = map[string]string{
+	base.RegistrationFlow: base.RegisterUserAction,
+	base.LoginFlow:        base.LoginUserAction,
+	base.SettingsFlow:     base.UpdateSettingsAction,
+	base.RecoveryFlow:     base.RecoverUserAction,
+}
+
+// kratosTraitPointers maps user field names to Kratos form field pointers.
+var kratosTraitPointers = map[string]string{
+	"username":   "#/traits/" + string(base.Username),
+	"email":      "#/traits/" + string(base.Email),
+	"first_name": "#/traits/" + string(base.FirstName),
+	"last_name":  "#/traits/" + string(base.LastName),
+	"password":   "#/password",
+}
+
+type KratosHookController struct {
+	Service         services.BaseKratosHookService
+	AuditService    services.BaseAuditService
+	HistoryService  services.BaseHistoryService
+	HooksConfig     *base.KratosHooksConfig
+	SchemaValidator *validator.Validate
+}
+
+func (controller KratosHookController) validSignature(
+	signature string, body []byte,
+) bool {
+	mac := hmac.New(sha256.New, []byte(controller.HooksConfig.Secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// Authenticate checks that hook is called by Kratos: request must have
+// shared secret in X-Kratos-Hook-Secret header or "sha256=" and hex
+// HMAC-SHA256 of body in X-Kratos-Hook-Signature header. Body is read up
+// to configured size, before request is authenticated.
+func (controller KratosHookController) Authenticate(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(
+		c.Writer, c.Request.Body, controller.HooksConfig.MaxBodySize,
+	))
+	if err != nil {
+		serviceError := base.ServiceError{
+			Summary: "Error reading request body",
+			Status:  http.StatusBadRequest,
+		}
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			serviceError.Summary = fmt.Sprintf(
+				"Kratos hook body can not exceed %d bytes", maxBytesError.Limit,
+			)
+			serviceError.Status = http.StatusRequestEntityTooLarge
+		}
+		c.Error(serviceError)
+		c.Abort()
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	secret := c.GetHeader(base.KratosHookSecretHeader)
+	signature := c.GetHeader(base.KratosHookSignatureHeader)
+	authenticated := false
+	if secret != "" {
+		authenticated = subtle.ConstantTimeCompare(
+			[]byte(secret), []byte(controller.HooksConfig.Secret),
+		) == 1
+	} else if signature != "" {
+		authenticated = controller.validSignature(signature, body)
+	}
+	if !authenticated {
+		c.Error(base.ServiceError{
+			Summary: "Kratos hook authentication failed",
+			Status:  http.StatusUnauthorized,
+		})
+		c.Abort()
+	}
+}
+
+func (controller KratosHookController) audit(
+	c *gin.Context, flow string, payload *api.KratosHookPayload,
+	user *api.UserResponse, err error,
+) {
+	if controller.AuditService == nil {
+		return
+	}
+
+	event := api.AuditEvent{
+		Action:       kratosHookActions[flow],
+		TargetUserId: payload.Identity.Id,
+		RequestId:    api.RequestId(c),
+		ClientIp:     payload.ClientIp,
+		Status:       http.StatusOK,
+	}
+	if user != nil {
+		event.Actor = user.Username
+	}
+	if event.ClientIp == "" {
+		event.ClientIp = c.ClientIP()
+	}
+	if err != nil {
+		event.Status = base.ErrorStatus(err)
+	}
+	var after *api.UserResponse
+	if flow == base.RegistrationFlow {
+		after = user
+	}
+	controller.AuditService.Record(&event, nil, after)
+}
+
+// HandleHook Handle Kratos hook godoc
+// @Summary      Handle Kratos self-service flow hook
+// @Description  This method is called by Kratos web_hook after registration,
+// @Description  login, settings and recovery flows. It records audit event
+// @Description  and publishes user.created event after registration and
+// @Description  user.updated event after settings flow. Kratos is
+// @Description  authenticated with shared secret in X-Kratos-Hook-Secret
+// @Description  header or HMAC-SHA256 of body in X-Kratos-Hook-Signature
+// @Tags         Kratos hooks
+// @Accept       json
+// @Produce      json
+// @Param        flow     path  string                 true "Flow" Enums(registration, login, settings, recovery)
+// @Param   	 request  body  api.KratosHookPayload  true "Hook payload"
+// @Param        X-Kratos-Hook-Secret     header string false "Shared secret"
+// @Param        X-Kratos-Hook-Signature  header string false "sha256= and hex HMAC-SHA256 of body"
+// @Success      204
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      401  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      413  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/hooks/kratos/{flow} [post]
+func (controller KratosHookController) HandleHook(c *gin.Context) {
+	flow := c.Param(base.KratosFlowPathParam)
+	api.Logger(c).Info("Requested Kratos " + flow + " hook")
+
+	if _, ok := kratosHookActions[flow]; !ok {
+		c.Error(base.ServiceError{
+			Summary: "Unknown Kratos flow '" + flow + "'",
+			Status:  http.StatusNotFound,
+		})
+		return
+	}
+
+	var payload api.KratosHookPayload
+	if err := c.BindJSON(&payload); err != nil {
+		return
+	}
+	if err := controller.SchemaValidator.Struct(payload); err != nil {
+		c.Error(base.WrapValidationErrors(err))
+		return
+	}
+
+	user, err := controller.Service.HandleHook(flow, &payload)
+	controller.audit(c, flow, &payload, user, err)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if flow == base.RegistrationFlow || flow == base.SettingsFlow {
+		recordHistory(
+			c,
+			controller.HistoryService,
+			user.Id,
+			user.Username,
+			base.KratosHookHistorySource,
+		)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func traitsToUser(traits map[string]any, password string) api.User {
+	trait := func(name base.SchemaProperty) string {
+		value, _ := traits[string(name)].(string)
+		return value
+	}
+	return api.User{
+		Username:  trait(base.Username),
+		Password:  password,
+		FirstName: trait(base.FirstName),
+		LastName:  trait(base.LastName),
+		Email:     trait(base.Email),
+	}
+}
+
+func toKratosErrorResponse(fieldErrors []base.FieldError) api.KratosErrorResponse {
+	response := api.KratosErrorResponse{}
+	for _, fieldError := range fieldErrors {
+		instancePtr, ok := kratosTraitPointers[fieldError.Name]
+		if !ok {
+			instancePtr = "#/traits/" + fieldError.Name
+		}
+		response.Messages = append(response.Messages, api.KratosFieldMessages{
+			InstancePtr: instancePtr,
+			Messages: []api.KratosMessage{{
+				Id:      base.KratosValidationMessageId,
+				Text:    fieldError.Message,
+				Type:    "error",
+				Context: map[string]any{"reason": fieldError.Message},
+			}},
+		})
+	}
+	return response
+}
+
+// passwordRequired returns true, if flow sets password and password must be
+// passed to validation hook. Registration without method is treated as
+// password one, so hook payload without method does not skip the check.
+func (controller KratosHookController) passwordRequired(
+	flow string, method string,
+) bool {
+	if !controller.HooksConfig.RequirePassword {
+		return false
+	}
+	return method == "password" || (method == "" && flow == base.RegistrationFlow)
+}
+
+// ValidateHook Validate Kratos identity godoc
+// @Summary      Validate identity in Kratos self-service flow
+// @Description  This method is called by Kratos web_hook with response.parse
+// @Description  before identity is saved in registration and settings flows.
+// @Description  Traits and password, if UI passes it in transient_payload,
+// @Description  are validated with the same rules as in user creation.
+// @Description  With kratos.hooks.requirePassword password method flows
+// @Description  without password are rejected. Errors are returned in
+// @Description  Kratos format and shown by UI near form fields
+// @Tags         Kratos hooks
+// @Accept       json
+// @Produce      json
+// @Param        flow     path  string                       true "Flow" Enums(registration, settings)
+// @Param   	 request  body  api.KratosValidationPayload  true "Hook payload"
+// @Param        X-Kratos-Hook-Secret     header string false "Shared secret"
+// @Param        X-Kratos-Hook-Signature  header string false "sha256= and hex HMAC-SHA256 of body"
+// @Success      200  {object}  api.KratosHookResponse
+// @Failure      400  {object}  api.KratosErrorResponse
+// @Failure      401  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      413  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/hooks/kratos/{flow}/validate [post]
+func (controller KratosHookController) ValidateHook(c *gin.Context) {
+	flow := c.Param(base.KratosFlowPathParam)
+	api.Logger(c).Info("Requested Kratos " + flow + " validation hook")
+
+	if flow != base.RegistrationFlow && flow != base.SettingsFlow {
+		c.Error(base.ServiceError{
+			Summary: "Validation of Kratos flow '" + flow + "' not supported",
+			Status:  http.StatusNotFound,
+		})
+		return
+	}
+
+	var payload api.KratosValidationPayload
+	if err := c.BindJSON(&payload); err != nil {
+		return
+	}
+	if err := controller.SchemaValidator.Struct(payload); err != nil {
+		c.Error(base.WrapValidationErrors(err))
+		return
+	}
+
+	user := traitsToUser(payload.Identity.Traits, payload.Password)
+	var err error
+	if payload.Password == "" {
+		if controller.passwordRequired(flow, payload.Method) {
+			c.JSON(http.StatusBadRequest, toKratosErrorResponse([]base.FieldError{{
+				Name:    "password",
+				Message: "Password was not passed for validation",
+			}}))
+			return
+		}
+		err = controller.SchemaValidator.StructExcept(user, "Password")
+	} else {
+		err = controller.SchemaValidator.Struct(user)
+	}
+	if err == nil {
+		if flow == base.SettingsFlow {
+			// Hook is called before change is saved
+			baselineHistory(c, controller.HistoryService, payload.Identity.Id)
+		}
+		c.JSON(http.StatusOK, api.KratosHookResponse{})
+		return
+	}
+
+	var serviceError base.ServiceError
+	var fieldErrors []base.FieldError
+	wrapped := base.WrapValidationErrors(err)
+	ok := errors.As(wrapped, &serviceError)
+	if ok {
+		fieldErrors, ok = serviceError.Detail.([]base.FieldError)
+	}
+	if !ok {
+		c.Error(wrapped)
+		return
+	}
+	c.JSON(http.StatusBadRequest, toKratosErrorResponse(fieldErrors))
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testHookSecret = "hook_secret_81736sjdhd"
+
+func testHookSignature(body string) string {
+	mac := hmac.New(sha256.New, []byte(testHookSecret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestKratosHookAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := `{"identity":{"id":"42"}}`
+	tests := []struct {
+		name    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{
+			name:    "secret",
+			body:    body,
+			headers: map[string]string{base.KratosHookSecretHeader: testHookSecret},
+		},
+		{
+			name: "signature",
+			body: body,
+			headers: map[string]string{
+				base.KratosHookSignatureHeader: testHookSignature(body),
+			},
+		},
+		{
+			name:    "wrong secret",
+			body:    body,
+			headers: map[string]string{base.KratosHookSecretHeader: "wrong"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name: "signature of other body",
+			body: body,
+			headers: map[string]string{
+				base.KratosHookSignatureHeader: testHookSignature("{}"),
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "missing credentials",
+			body:   body,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:    "body too large",
+			body:    strings.Repeat("x", 65),
+			headers: map[string]string{base.KratosHookSecretHeader: testHookSecret},
+			status:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	controller := KratosHookController{
+		HooksConfig: &base.KratosHooksConfig{
+			Secret:      testHookSecret,
+			MaxBodySize: 64,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(
+				http.MethodPost,
+				"/v1/hooks/kratos/login",
+				strings.NewReader(test.body),
+			)
+			for name, value := range test.headers {
+				c.Request.Header.Set(name, value)
+			}
+
+			controller.Authenticate(c)
+			if test.status == 0 {
+				if c.IsAborted() {
+					t.Fatalf("unexpected errors: %v", c.Errors)
+				}
+				if restored, _ := io.ReadAll(c.Request.Body); string(restored) != body {
+					t.Errorf("body is not restored, got %q", restored)
+				}
+				return
+			}
+			var serviceError base.ServiceError
+			if !c.IsAborted() || !errors.As(c.Errors.Last().Err, &serviceError) {
+				t.Fatalf("expected service error, got %v", c.Errors)
+			}
+			if serviceError.Status != test.status {
+				t.Errorf(
+					"expected status %d, got %d", test.status, serviceError.Status,
+				)
+			}
+		})
+	}
+}
+
+func TestKratosValidateHook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	identity := &api.KratosHookIdentity{
+		Id: "42",
+		Traits: map[string]any{
+			string(base.Username):  "john",
+			string(base.Email):     "john@example.com",
+			string(base.FirstName): "John",
+			string(base.LastName):  "Doe",
+		},
+	}
+	tests := []struct {
+		name            string
+		flow            string
+		method          string
+		password        string
+		requirePassword bool
+		status          int
+		instancePtr     string
+	}{
+		{
+			name:     "registration with password",
+			flow:     base.RegistrationFlow,
+			method:   "password",
+			password: "Jsk2#kdL9s!w",
+			status:   http.StatusOK,
+		},
+		{
+			name:     "registration with weak password",
+			flow:     base.RegistrationFlow,
+			method:   "password",
+			password: "123",
+			status:   http.StatusBadRequest,
+		},
+		{
+			name:   "registration without password",
+			flow:   base.RegistrationFlow,
+			method: "password",
+			status: http.StatusOK,
+		},
+		{
+			name:            "registration without password, password required",
+			flow:            base.RegistrationFlow,
+			method:          "password",
+			requirePassword: true,
+			status:          http.StatusBadRequest,
+			instancePtr:     "#/password",
+		},
+		{
+			name:            "registration without method, password required",
+			flow:            base.RegistrationFlow,
+			requirePassword: true,
+			status:          http.StatusBadRequest,
+			instancePtr:     "#/password",
+		},
+		{
+			name:            "profile settings, password required",
+			flow:            base.SettingsFlow,
+			method:          "profile",
+			requirePassword: true,
+			status:          http.StatusOK,
+		},
+		{
+			name:            "password settings, password required",
+			flow:            base.SettingsFlow,
+			method:          "password",
+			requirePassword: true,
+			status:          http.StatusBadRequest,
+			instancePtr:     "#/password",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			controller := KratosHookController{
+				HooksConfig: &base.KratosHooksConfig{
+					RequirePassword: test.requirePassword,
+				},
+				SchemaValidator: base.CreateValidator(),
+			}
+			payload := api.KratosValidationPayload{
+				KratosHookPayload: api.KratosHookPayload{Identity: identity},
+				Method:            test.method,
+				Password:          test.password,
+			}
+			body, _ := json.Marshal(&payload)
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Params = gin.Params{
+				{Key: base.KratosFlowPathParam, Value: test.flow},
+			}
+			c.Request = httptest.NewRequest(
+				http.MethodPost,
+				"/v1/hooks/kratos/"+test.flow+"/validate",
+				bytes.NewReader(body),
+			)
+
+			controller.ValidateHook(c)
+			if recorder.Code != test.status {
+				t.Fatalf(
+					"expected status %d, got %d: %s",
+					test.status, recorder.Code, recorder.Body.String(),
+				)
+			}
+			if test.instancePtr == "" {
+				return
+			}
+			var response api.KratosErrorResponse
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+			if len(response.Messages) != 1 ||
+				response.Messages[0].InstancePtr != test.instancePtr {
+				t.Errorf(
+					"expected error of %s, got %s",
+					test.instancePtr, recorder.Body.String(),
+				)
+			}
+		})
+	}
+}
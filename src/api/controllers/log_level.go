@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type LogLevelController struct {
+	Service         services.BaseLogLevelService
+	SchemaValidator *validator.Validate
+}
+
+// GetLogLevel Get log level godoc
+// @Summary      Get log level
+// @Description  This method returns current log level, configured level
+// @Description  and time when changed level is reverted
+// @Tags         Admin
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  api.LogLevelResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/admin/log-level [get]
+func (controller LogLevelController) GetLogLevel(c *gin.Context) {
+	api.Logger(c).Info("Requested log level")
+
+	c.IndentedJSON(http.StatusOK, controller.Service.GetLevel())
+}
+
+// SetLogLevel Change log level godoc
+// @Summary      Change log level
+// @Description  This method changes log level of sinks without own level.
+// @Description  Level is reverted to configured one after TTL (seconds),
+// @Description  every change is audited
+// @Tags         Admin
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param   	 request  body  api.LogLevelRequest true "Log level"
+// @Success      200  {object}  api.LogLevelResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/admin/log-level [put]
+func (controller LogLevelController) SetLogLevel(c *gin.Context) {
+	api.Logger(c).Info("Requested changing log level")
+
+	var request api.LogLevelRequest
+	if err := c.BindJSON(&request); err != nil {
+		return
+	}
+	if err := controller.SchemaValidator.Struct(request); err != nil {
+		c.Error(base.WrapValidationErrors(err))
+		return
+	}
+
+	event := api.AuditEvent{
+		RequestId: api.RequestId(c),
+		ClientIp:  c.ClientIP(),
+		Status:    http.StatusOK,
+	}
+	if user := api.CurrentUser(c); user != nil {
+		event.Actor = user.Username
+	}
+	response, err := controller.Service.SetLevel(&request, &event)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"crypto/subtle"
+	"expvar"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"strings"
+)
+
+// OpsController serves operational endpoints on a separate listener, which
+// is not exposed with user management API.
+type OpsController struct {
+	OpsConfig *base.OpsConfig
+	Health    HealthController
+}
+
+// Authenticate checks bearer token, if it is configured.
+func (controller OpsController) Authenticate(c *gin.Context) {
+	if controller.OpsConfig.Token == "" {
+		c.Next()
+		return
+	}
+
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare(
+		[]byte(token), []byte(controller.OpsConfig.Token),
+	) != 1 {
+		c.Error(base.ServiceError{
+			Summary: "Authorization token invalid",
+			Status:  http.StatusUnauthorized,
+		})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// Live reports that process is running and serves requests.
+func (controller OpsController) Live(c *gin.Context) {
+	controller.Health.Live(c)
+}
+
+// Ready reports whether dependencies are available and service accepts
+// traffic with details of every dependency.
+func (controller OpsController) Ready(c *gin.Context) {
+	controller.Health.ReadyDetails(c)
+}
+
+// Metrics serves runtime metrics in expvar JSON format.
+func (controller OpsController) Metrics(c *gin.Context) {
+	expvar.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
+// BuildInfo returns version of service and VCS revision it was built from.
+func (controller OpsController) BuildInfo(c *gin.Context) {
+	response := api.BuildInfoResponse{Version: base.Version}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		response.GoVersion = info.GoVersion
+		response.Module = info.Main.Path
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				response.Revision = setting.Value
+			case "vcs.time":
+				response.RevisionTime = setting.Value
+			case "vcs.modified":
+				response.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// Profile serves net/http/pprof index and profiles by name.
+func (controller OpsController) Profile(c *gin.Context) {
+	switch strings.TrimPrefix(c.Param(base.ProfileNamePathParam), "/") {
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestOpsRouter serves operational endpoints like operations listener.
+func newTestOpsRouter(token string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controller := OpsController{
+		OpsConfig: &base.OpsConfig{Enabled: true, Token: token},
+		Health: HealthController{Service: staticHealthService{
+			response: api.ReadinessResponse{
+				Status: base.HealthStatusOk,
+				Dependencies: map[string]api.DependencyStatus{
+					"kratos": {Status: base.HealthStatusOk},
+				},
+			},
+		}},
+	}
+	router := gin.New()
+	router.Use(api.ErrorHandler)
+	router.Use(controller.Authenticate)
+	router.GET("/health/live", controller.Live)
+	router.GET("/health/ready", controller.Ready)
+	router.GET("/build-info", controller.BuildInfo)
+	return router
+}
+
+func TestOpsAuthenticate(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		status        int
+	}{
+		{name: "token not configured", status: http.StatusOK},
+		{
+			name:          "token not configured, any token",
+			authorization: "Bearer anything",
+			status:        http.StatusOK,
+		},
+		{name: "missing token", token: "ops-token", status: http.StatusUnauthorized},
+		{
+			name:          "invalid token",
+			token:         "ops-token",
+			authorization: "Bearer ops-tokem",
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:          "token prefix",
+			token:         "ops-token",
+			authorization: "Bearer ops",
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:          "not bearer token",
+			token:         "ops-token",
+			authorization: "Basic ops-token",
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:          "valid token",
+			token:         "ops-token",
+			authorization: "Bearer ops-token",
+			status:        http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := newTestOpsRouter(test.token)
+			for _, path := range []string{"/health/live", "/health/ready", "/build-info"} {
+				request := httptest.NewRequest(http.MethodGet, path, nil)
+				if test.authorization != "" {
+					request.Header.Set("Authorization", test.authorization)
+				}
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, request)
+				if recorder.Code != test.status {
+					t.Errorf("expected %s status %d, got %d", path, test.status, recorder.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestOpsEndpoints(t *testing.T) {
+	router := newTestOpsRouter("ops-token")
+	get := func(path string, response any) {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("Authorization", "Bearer ops-token")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected %s status 200, got %d", path, recorder.Code)
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+			t.Fatalf("invalid %s response: %s", path, err)
+		}
+	}
+
+	var readiness api.ReadinessResponse
+	get("/health/ready", &readiness)
+	if _, ok := readiness.Dependencies["kratos"]; !ok {
+		t.Errorf("expected dependency details, got %+v", readiness)
+	}
+
+	var buildInfo api.BuildInfoResponse
+	get("/build-info", &buildInfo)
+	if buildInfo.Version != base.Version || buildInfo.GoVersion == "" {
+		t.Errorf("unexpected build info %+v", buildInfo)
+	}
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"strings"
+)
+
+type PolicyController struct {
+	Service         services.BasePolicyService
+	UserService     services.BaseUserService
+	SchemaValidator *validator.Validate
+	BasePath        string
+}
+
+func callerFromContext(c *gin.Context) *api.PolicyCaller {
+	user := api.CurrentUser(c)
+	if user == nil {
+		return nil
+	}
+	return &api.PolicyCaller{
+		Name:        user.Username,
+		Role:        user.Role,
+		Permissions: user.Permissions,
+	}
+}
+
+func (controller PolicyController) loadTarget(
+	c *gin.Context, input *api.PolicyInput,
+) error {
+	userId, ok := input.Params[base.UserIdPathParam]
+	if input.Target != nil || !ok || userId == "" {
+		return nil
+	}
+
+	user, err := controller.UserService.WithRequestContext(
+		c.Request.Context(),
+	).GetUser(userId)
+	if err != nil {
+		return err
+	}
+	input.Target = map[string]any{
+		"id":    user.Id,
+		"state": user.State,
+		"traits": map[string]any{
+			string(base.Username):  user.Username,
+			string(base.Email):     user.Email,
+			string(base.FirstName): user.FirstName,
+			string(base.LastName):  user.LastName,
+		},
+	}
+	return nil
+}
+
+func (controller PolicyController) Enforce(c *gin.Context) {
+	input := api.PolicyInput{
+		Caller: callerFromContext(c),
+		Route:  strings.TrimPrefix(c.FullPath(), controller.BasePath),
+		Method: c.Request.Method,
+		Params: make(map[string]string, len(c.Params)),
+	}
+	for _, param := range c.Params {
+		input.Params[param.Key] = param.Value
+	}
+	if err := controller.loadTarget(c, &input); err != nil {
+		c.Error(err)
+		c.Abort()
+		return
+	}
+
+	decision, err := controller.Service.Evaluate(&input)
+	if err != nil {
+		c.Error(err)
+		c.Abort()
+		return
+	}
+	if !decision.Allowed {
+		c.Error(base.ServiceError{
+			Summary: fmt.Sprintf("Denied by policy rule '%s'", *decision.Rule),
+			Detail:  decision.Message,
+			Status:  http.StatusForbidden,
+		})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// EvaluatePolicy Evaluate policies godoc
+// @Summary      Evaluate policies
+// @Description  This method evaluates loaded policies against given input.
+// @Description  Authenticated caller is used if input caller is not set,
+// @Description  target is loaded by 'user_id' param if input target is not set
+// @Tags         Authorization
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param   	 request  body  api.PolicyInput true "Policy input"
+// @Success      200  {object}  api.PolicyDecision
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/authz/evaluate [post]
+func (controller PolicyController) EvaluatePolicy(c *gin.Context) {
+	api.Logger(c).Info("Requested policy evaluation")
+
+	var request api.PolicyInput
+	if err := c.BindJSON(&request); err != nil {
+		return
+	}
+	if err := controller.SchemaValidator.Struct(request); err != nil {
+		c.Error(base.WrapValidationErrors(err))
+		return
+	}
+
+	if request.Caller == nil {
+		request.Caller = callerFromContext(c)
+	}
+	if err := controller.loadTarget(c, &request); err != nil {
+		c.Error(err)
+		return
+	}
+
+	decision, err := controller.Service.Evaluate(&request)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, decision)
+}
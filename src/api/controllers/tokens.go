@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type TokenController struct {
+	Service         services.BaseTokenService
+	SchemaValidator *validator.Validate
+}
+
+// IssueToken Exchange credential for access token godoc
+// @Summary      Issue short-lived access token
+// @Description  This method exchanges caller's credential for a signed
+// @Description  access token limited to requested scopes, TTL (seconds)
+// @Description  and optionally to specific users
+// @Tags         Authorization
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param   	 request  body  api.TokenRequest true "Token request"
+// @Success      201  {object}  api.TokenResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/auth/token [post]
+func (controller TokenController) IssueToken(c *gin.Context) {
+	api.Logger(c).Info("Requested issuing access token")
+
+	var request api.TokenRequest
+	if err := c.BindJSON(&request); err != nil {
+		return
+	}
+	if err := controller.SchemaValidator.Struct(request); err != nil {
+		c.Error(base.WrapValidationErrors(err))
+		return
+	}
+
+	caller := api.CurrentUser(c)
+	if caller == nil {
+		c.Error(base.ServiceError{Summary: "Caller is not authorized"})
+		return
+	}
+	response, err := controller.Service.IssueToken(caller, &request)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, response)
+}
+
+// RevokeToken Revoke access token godoc
+// @Summary      Revoke access token
+// @Description  This method revokes issued access token before it expires
+// @Tags         Authorization
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param   	 request  body  api.RevokeTokenRequest true "Revoked token"
+// @Success      204
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/auth/token/revoke [post]
+func (controller TokenController) RevokeToken(c *gin.Context) {
+	api.Logger(c).Info("Requested revoking access token")
+
+	var request api.RevokeTokenRequest
+	if err := c.BindJSON(&request); err != nil {
+		return
+	}
+	if err := controller.SchemaValidator.Struct(request); err != nil {
+		c.Error(base.WrapValidationErrors(err))
+		return
+	}
+
+	if err := controller.Service.RevokeToken(request.TokenId); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusNoContent, nil)
+}
@@ -6,6 +6,7 @@ import (
 	"access-backend/base"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
 )
@@ -13,6 +14,103 @@ import (
 type UserController struct {
 	Service         services.BaseUserService
 	SchemaValidator *validator.Validate
+	AuditService    services.BaseAuditService
+	HistoryService  services.BaseHistoryService
+	DeletionService services.BaseDeletionService
+}
+
+func recordHistory(
+	c *gin.Context,
+	history services.BaseHistoryService,
+	userId string,
+	actor string,
+	source string,
+) {
+	if history == nil || userId == "" {
+		return
+	}
+	history = history.WithRequestContext(c.Request.Context())
+	if err := history.Record(userId, actor, source); err != nil {
+		api.Logger(c).WithFields(logrus.Fields{
+			"user_id": userId,
+			"error":   err.Error(),
+		}).Error("User history recording error")
+	}
+}
+
+// baselineHistory records current state of user without history before
+// change.
+func baselineHistory(
+	c *gin.Context, history services.BaseHistoryService, userId string,
+) {
+	if history == nil || userId == "" {
+		return
+	}
+	history = history.WithRequestContext(c.Request.Context())
+	if err := history.Baseline(userId); err != nil {
+		api.Logger(c).WithFields(logrus.Fields{
+			"user_id": userId,
+			"error":   err.Error(),
+		}).Error("User history baseline recording error")
+	}
+}
+
+func (controller UserController) recordHistory(c *gin.Context, userId string) {
+	actor := ""
+	if user := api.CurrentUser(c); user != nil {
+		actor = user.Username
+	}
+	recordHistory(
+		c, controller.HistoryService, userId, actor, base.ApiHistorySource,
+	)
+}
+
+// service returns user service, which calls Kratos in request span with
+// request id.
+func (controller UserController) service(c *gin.Context) services.BaseUserService {
+	return controller.Service.WithRequestContext(c.Request.Context())
+}
+
+func (controller UserController) getUserBefore(
+	c *gin.Context, userId string,
+) *api.UserResponse {
+	if controller.AuditService == nil {
+		return nil
+	}
+	user, err := controller.service(c).GetUser(userId)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+func (controller UserController) audit(
+	c *gin.Context,
+	action string,
+	userId string,
+	status int,
+	err error,
+	before *api.UserResponse,
+	after *api.UserResponse,
+) {
+	if controller.AuditService == nil {
+		return
+	}
+
+	event := api.AuditEvent{
+		Action:       action,
+		TargetUserId: userId,
+		RequestId:    api.RequestId(c),
+		ClientIp:     c.ClientIP(),
+		Status:       status,
+	}
+	if user := api.CurrentUser(c); user != nil {
+		event.Actor = user.Username
+	}
+	if err != nil {
+		event.Status = base.ErrorStatus(err)
+	}
+	controller.AuditService.Record(&event, before, after)
 }
 
 // AddUser Add new user godoc
@@ -25,28 +123,39 @@ type UserController struct {
 // @Param   	 request  body  api.AddUserRequest true "User sign-up schema"
 // @Success      201  {object}  api.UserResponse
 // @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
 // @Failure      422  {object}  api.ErrorResponse
 // @Failure      500  {object}  api.ErrorResponse
 // @Router       /v1/users [post]
 func (controller UserController) AddUser(c *gin.Context) {
-	base.Logger.Info("Requested creating user")
+	api.Logger(c).Info("Requested creating user")
 
 	var request api.AddUserRequest
 	if err := c.BindJSON(&request); err != nil {
 		return
 	}
 
+	_, span := base.Tracer.Start(c.Request.Context(), "ValidateUser")
 	err := controller.SchemaValidator.Struct(request)
+	span.End()
 	if err != nil {
 		c.Error(base.WrapValidationErrors(err))
 		return
 	}
 
-	user, err := controller.Service.AddUser(&request)
+	user, err := controller.service(c).AddUser(&request)
+	userId := ""
+	if user != nil {
+		userId = user.Id
+	}
+	controller.audit(
+		c, base.CreateUserAction, userId, http.StatusCreated, err, nil, user,
+	)
 	if err != nil {
 		c.Error(err)
 		return
 	}
+	controller.recordHistory(c, userId)
 
 	c.IndentedJSON(http.StatusCreated, user)
 }
@@ -61,11 +170,12 @@ func (controller UserController) AddUser(c *gin.Context) {
 // @Param 		 _ 	  query     api.PaginationQueryParameters false "Pagination parameters"
 // @Success      201  {object}  api.GetUsersResponse
 // @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
 // @Failure      422  {object}  api.ErrorResponse
 // @Failure      500  {object}  api.ErrorResponse
 // @Router       /v1/users [get]
 func (controller UserController) GetUsers(c *gin.Context) {
-	base.Logger.Info("Requested list of users")
+	api.Logger(c).Info("Requested list of users")
 
 	queryParams := api.PaginationQueryParameters{}
 
@@ -85,7 +195,7 @@ func (controller UserController) GetUsers(c *gin.Context) {
 		return
 	}
 
-	response, err := controller.Service.GetUsers(&queryParams)
+	response, err := controller.service(c).GetUsers(&queryParams)
 	if err != nil {
 		c.Error(err)
 		return
@@ -96,19 +206,25 @@ func (controller UserController) GetUsers(c *gin.Context) {
 
 // DeleteUser Delete user godoc
 // @Summary      Delete user by id
-// @Description  This method removes user
+// @Description  This method removes user. If deletion hooks are enabled,
+// @Description  deletion saga is started and its status is returned with
+// @Description  202 status, user is deleted after all downstream services
 // @Tags         Users
 // @Security     User
 // @Accept       json
 // @Produce      json
 // @Param 		 id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
 // @Success      204
+// @Success      202  {object}  api.DeletionStatusResponse
 // @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      409  {object}  api.ErrorResponse
 // @Failure      422  {object}  api.ErrorResponse
 // @Failure      500  {object}  api.ErrorResponse
 // @Router       /v1/users/{user_id} [delete]
 func (controller UserController) DeleteUser(c *gin.Context) {
-	base.Logger.Info("Requested deleting user")
+	api.Logger(c).Info("Requested deleting user")
 
 	fileId := c.Param(base.UserIdPathParam)
 	if fileId == "" {
@@ -116,7 +232,127 @@ func (controller UserController) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	err := controller.Service.DeleteUser(fileId)
+	before := controller.getUserBefore(c, fileId)
+	if controller.DeletionService != nil {
+		actor := ""
+		if user := api.CurrentUser(c); user != nil {
+			actor = user.Username
+		}
+		deletion, err := controller.DeletionService.WithRequestContext(
+			c.Request.Context(),
+		).Start(fileId, actor)
+		controller.audit(
+			c, base.DeleteUserAction, fileId, http.StatusAccepted, err, before, nil,
+		)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		c.IndentedJSON(http.StatusAccepted, deletion)
+		return
+	}
+
+	err := controller.service(c).DeleteUser(fileId)
+	controller.audit(
+		c, base.DeleteUserAction, fileId, http.StatusNoContent, err, before, nil,
+	)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusNoContent, nil)
+}
+
+func (controller UserController) setUserState(
+	c *gin.Context, state string, action string,
+) {
+	userId := c.Param(base.UserIdPathParam)
+	if userId == "" {
+		c.Error(base.NewPathParamRequiredError(base.UserIdPathParam))
+		return
+	}
+
+	before := controller.getUserBefore(c, userId)
+	baselineHistory(c, controller.HistoryService, userId)
+	user, err := controller.service(c).SetUserState(userId, state)
+	controller.audit(c, action, userId, http.StatusOK, err, before, user)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	controller.recordHistory(c, userId)
+
+	c.IndentedJSON(http.StatusOK, user)
+}
+
+// DeactivateUser Deactivate user godoc
+// @Summary      Deactivate user by id
+// @Description  This method deactivates user, so user can not sign in
+// @Tags         Users
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
+// @Success      200  {object}  api.UserResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/users/{user_id}/deactivate [post]
+func (controller UserController) DeactivateUser(c *gin.Context) {
+	api.Logger(c).Info("Requested deactivating user")
+
+	controller.setUserState(c, base.StateInactive, base.DeactivateUserAction)
+}
+
+// ActivateUser Activate user godoc
+// @Summary      Activate user by id
+// @Description  This method activates previously deactivated user
+// @Tags         Users
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
+// @Success      200  {object}  api.UserResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/users/{user_id}/activate [post]
+func (controller UserController) ActivateUser(c *gin.Context) {
+	api.Logger(c).Info("Requested activating user")
+
+	controller.setUserState(c, base.StateActive, base.ActivateUserAction)
+}
+
+// RevokeSessions Revoke user sessions godoc
+// @Summary      Revoke user sessions
+// @Description  This method invalidates all sessions of user
+// @Tags         Users
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 id path string true "User id" example(6e98ca78-d3ea-4682-adf1-51c12585e7d7)
+// @Success      204
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/users/{user_id}/sessions [delete]
+func (controller UserController) RevokeSessions(c *gin.Context) {
+	api.Logger(c).Info("Requested revoking user sessions")
+
+	userId := c.Param(base.UserIdPathParam)
+	if userId == "" {
+		c.Error(base.NewPathParamRequiredError(base.UserIdPathParam))
+		return
+	}
+
+	err := controller.service(c).RevokeSessions(userId)
+	controller.audit(
+		c, base.RevokeSessionsAction, userId, http.StatusNoContent, err, nil, nil,
+	)
 	if err != nil {
 		c.Error(err)
 		return
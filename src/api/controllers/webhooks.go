@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"access-backend/api"
+	"access-backend/api/services"
+	"access-backend/base"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type WebhookController struct {
+	Service         services.BaseWebhookService
+	SchemaValidator *validator.Validate
+}
+
+// GetWebhooks Get webhooks godoc
+// @Summary      Get webhook subscriptions
+// @Description  This method returns webhook subscriptions from
+// @Description  configuration file and added with API
+// @Tags         Webhooks
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   api.WebhookResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/webhooks [get]
+func (controller WebhookController) GetWebhooks(c *gin.Context) {
+	api.Logger(c).Info("Requested list of webhooks")
+
+	c.IndentedJSON(http.StatusOK, controller.Service.GetWebhooks())
+}
+
+// AddWebhook Add webhook godoc
+// @Summary      Add webhook subscription
+// @Description  This method subscribes URL to user lifecycle events.
+// @Description  URL must match webhooks.allowedSchemes and allowedHosts
+// @Description  and can not point to private addresses
+// @Tags         Webhooks
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param   	 request  body  api.WebhookRequest true "Webhook subscription"
+// @Success      201  {object}  api.WebhookResponse
+// @Failure      400  {object}  api.ErrorResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      422  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/webhooks [post]
+func (controller WebhookController) AddWebhook(c *gin.Context) {
+	api.Logger(c).Info("Requested adding webhook")
+
+	var request api.WebhookRequest
+	if err := c.BindJSON(&request); err != nil {
+		return
+	}
+	if err := controller.SchemaValidator.Struct(request); err != nil {
+		c.Error(base.WrapValidationErrors(err))
+		return
+	}
+
+	webhook, err := controller.Service.AddWebhook(&request)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, webhook)
+}
+
+// DeleteWebhook Delete webhook godoc
+// @Summary      Delete webhook subscription
+// @Description  This method removes webhook subscription added with API
+// @Tags         Webhooks
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 id path string true "Webhook id" example(3f9a2c7d1b8e4f60)
+// @Success      204
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      409  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/webhooks/{webhook_id} [delete]
+func (controller WebhookController) DeleteWebhook(c *gin.Context) {
+	api.Logger(c).Info("Requested deleting webhook")
+
+	webhookId := c.Param(base.WebhookIdPathParam)
+	if webhookId == "" {
+		c.Error(base.NewPathParamRequiredError(base.WebhookIdPathParam))
+		return
+	}
+
+	if err := controller.Service.DeleteWebhook(webhookId); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusNoContent, nil)
+}
+
+// GetDeadLetters Get dead letters godoc
+// @Summary      Get undelivered webhook events
+// @Description  This method returns webhook deliveries failed all attempts
+// @Tags         Webhooks
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   api.WebhookDelivery
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/webhooks/dead-letters [get]
+func (controller WebhookController) GetDeadLetters(c *gin.Context) {
+	api.Logger(c).Info("Requested webhook dead letters")
+
+	c.IndentedJSON(http.StatusOK, controller.Service.GetDeadLetters())
+}
+
+// Redeliver Redeliver dead letter godoc
+// @Summary      Redeliver webhook event
+// @Description  This method moves dead letter back to delivery queue
+// @Tags         Webhooks
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Param 		 id path string true "Delivery id" example(9c1d7e2a5b3f8064)
+// @Success      202
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      404  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Failure      503  {object}  api.ErrorResponse
+// @Router       /v1/webhooks/dead-letters/{delivery_id}/redeliver [post]
+func (controller WebhookController) Redeliver(c *gin.Context) {
+	api.Logger(c).Info("Requested webhook redelivery")
+
+	deliveryId := c.Param(base.DeliveryIdPathParam)
+	if deliveryId == "" {
+		c.Error(base.NewPathParamRequiredError(base.DeliveryIdPathParam))
+		return
+	}
+
+	if err := controller.Service.Redeliver(deliveryId); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusAccepted, nil)
+}
+
+// GetWebhookStats Get webhook delivery stats godoc
+// @Summary      Get webhook delivery statistics
+// @Description  This method returns webhook delivery counters
+// @Tags         Webhooks
+// @Security     User
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  api.WebhookStatsResponse
+// @Failure      403  {object}  api.ErrorResponse
+// @Failure      500  {object}  api.ErrorResponse
+// @Router       /v1/webhooks/stats [get]
+func (controller WebhookController) GetWebhookStats(c *gin.Context) {
+	api.Logger(c).Info("Requested webhook stats")
+
+	c.IndentedJSON(http.StatusOK, controller.Service.GetStats())
+}
@@ -2,57 +2,251 @@ package api
 
 import (
 	"access-backend/base"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func NoRouteHandler(c *gin.Context) {
-	response := ErrorResponse{
-		Summary: "Route not found",
+type requestIdKey struct{}
+
+// maxRequestIdLength limits length of request id accepted from client.
+const maxRequestIdLength = 128
+
+// ContextWithRequestId returns context, which carries request id to
+// outgoing calls.
+func ContextWithRequestId(ctx context.Context, requestId string) context.Context {
+	if requestId == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestIdFromContext returns request id set by RequestIdHandler or empty
+// string.
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+	for _, symbol := range requestId {
+		if symbol < '!' || symbol > '~' {
+			return false
+		}
 	}
+	return true
+}
+
+func generateRequestId() string {
+	content := make([]byte, 16)
+	if _, err := rand.Read(content); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(content)
+}
+
+// RequestIdHandler takes request id from X-Request-ID header or generates
+// it and returns it in response header. Request id is added to request
+// context and to request-scoped logger.
+func RequestIdHandler(c *gin.Context) {
+	requestId := c.GetHeader(base.RequestIdHeader)
+	if !validRequestId(requestId) {
+		requestId = generateRequestId()
+	}
+
+	ctx := ContextWithRequestId(c.Request.Context(), requestId)
+	c.Request = c.Request.WithContext(ctx)
+	c.Set(base.RequestIdContextKey, requestId)
+	c.Set(base.LoggerContextKey, base.Logger.WithContext(ctx).WithField(
+		base.RequestIdContextKey, requestId,
+	))
+	c.Header(base.RequestIdHeader, requestId)
+
+	c.Next()
+}
+
+// Logger returns request-scoped logger, which adds request and trace ids
+// to entries.
+func Logger(c *gin.Context) *logrus.Entry {
+	value, _ := c.Get(base.LoggerContextKey)
+	if logger, ok := value.(*logrus.Entry); ok {
+		return logger
+	}
+	return base.Logger.WithContext(c.Request.Context())
+}
+
+func newErrorResponse(c *gin.Context, summary string, detail any) ErrorResponse {
+	return ErrorResponse{
+		Summary:   summary,
+		Detail:    detail,
+		TraceId:   base.TraceId(c.Request.Context()),
+		RequestId: RequestId(c),
+	}
+}
+
+func NoRouteHandler(c *gin.Context) {
+	response := newErrorResponse(c, "Route not found", nil)
 	statusCode := http.StatusNotFound
 
 	c.JSON(statusCode, response)
 }
 
 func NoMethodHandler(c *gin.Context) {
-	response := ErrorResponse{
-		Summary: "Method not allowed",
-	}
+	response := newErrorResponse(c, "Method not allowed", nil)
 	statusCode := http.StatusMethodNotAllowed
 
 	c.JSON(statusCode, response)
 }
 
-func LogsHandler(c *gin.Context) {
-	base.Logger.WithFields(logrus.Fields{
-		"path":   c.Request.URL.Path,
-		"method": c.Request.Method,
-	}).Info("Incoming request")
+// redactedValue replaces values of sensitive headers in access logs.
+const redactedValue = "[REDACTED]"
+
+// errorSummary returns summaries of errors added to request context.
+func errorSummary(c *gin.Context) string {
+	summaries := make([]string, 0, len(c.Errors))
+	for _, err := range c.Errors {
+		var parsedError base.ServiceError
+		if errors.As(err.Err, &parsedError) {
+			summaries = append(summaries, parsedError.Summary)
+		} else {
+			summaries = append(summaries, err.Error())
+		}
+	}
+	return strings.Join(summaries, "; ")
+}
+
+// LogsHandler logs completed request in a single entry with latency,
+// response size, client and caller. Requests to skipped paths are logged
+// only if they fail or are slow, slow requests are logged with warn level.
+func LogsHandler(config *base.AccessLogConfig) gin.HandlerFunc {
+	skipPaths := make(map[string]bool, len(config.SkipPaths))
+	for _, path := range config.SkipPaths {
+		skipPaths[path] = true
+	}
+	redactHeaders := make(map[string]bool, len(config.RedactHeaders))
+	for _, header := range config.RedactHeaders {
+		redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		Logger(c).WithFields(logrus.Fields{
+			"path":   path,
+			"method": c.Request.Method,
+		}).Debug("Incoming request")
+
+		c.Next()
+
+		duration := time.Since(start)
+		status := c.Writer.Status()
+		route := c.FullPath()
+		slow := config.SlowThreshold > 0 && duration >= config.SlowThreshold
+		skipped := skipPaths[path] || (route != "" && skipPaths[route])
+		if skipped && !slow && status < http.StatusBadRequest {
+			return
+		}
+
+		fields := logrus.Fields{
+			"path":          path,
+			"route":         route,
+			"method":        c.Request.Method,
+			"status":        status,
+			"duration_ms":   float64(duration.Microseconds()) / 1000,
+			"response_size": max(c.Writer.Size(), 0),
+			"client_ip":     c.ClientIP(),
+			"user_agent":    c.Request.UserAgent(),
+		}
+		if user := CurrentUser(c); user != nil {
+			fields["actor"] = user.Username
+		}
+		if summary := errorSummary(c); summary != "" {
+			fields["error"] = summary
+		}
+		if len(config.Headers) > 0 {
+			headers := make(map[string]string, len(config.Headers))
+			for _, header := range config.Headers {
+				value := c.GetHeader(header)
+				if value == "" {
+					continue
+				}
+				if redactHeaders[http.CanonicalHeaderKey(header)] {
+					value = redactedValue
+				}
+				headers[header] = value
+			}
+			if len(headers) > 0 {
+				fields["headers"] = headers
+			}
+		}
+
+		logger := Logger(c).WithFields(fields)
+		if slow {
+			logger.Warn("Slow request")
+			return
+		}
+		logger.Info("Outgoing response")
+	}
+}
+
+// MetricsHandler records HTTP requests metrics labeled by route template,
+// so paths with ids do not produce separate series.
+func MetricsHandler(c *gin.Context) {
+	base.HttpRequestsInFlight.Inc()
+	defer base.HttpRequestsInFlight.Dec()
+	start := time.Now()
 
 	c.Next()
 
-	base.Logger.WithFields(logrus.Fields{
-		"path":   c.Request.URL.Path,
-		"method": c.Request.Method,
-		"status": c.Writer.Status(),
-	}).Info("Outgoing response")
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	labels := []string{
+		route, c.Request.Method, strconv.Itoa(c.Writer.Status()),
+	}
+	base.HttpRequestsTotal.WithLabelValues(labels...).Inc()
+	base.HttpRequestDuration.WithLabelValues(labels...).Observe(
+		time.Since(start).Seconds(),
+	)
+}
+
+// CurrentUser returns caller authorized by AuthController.Authorize or nil.
+func CurrentUser(c *gin.Context) *AdminUser {
+	value, _ := c.Get(base.AuthContextKey)
+	user, _ := value.(*AdminUser)
+	return user
+}
+
+// RequestId returns id of request set by RequestIdHandler.
+func RequestId(c *gin.Context) string {
+	if requestId := c.GetString(base.RequestIdContextKey); requestId != "" {
+		return requestId
+	}
+	return c.GetHeader(base.RequestIdHeader)
 }
 
 func ErrorHandler(c *gin.Context) {
 	defer func() {
 		if r := recover(); r != nil {
-			base.Logger.WithFields(logrus.Fields{
+			Logger(c).WithFields(logrus.Fields{
 				"detail": fmt.Sprint(r),
 			}).Error("Unknown processing request error")
 
-			response := ErrorResponse{
-				Summary: "Unexpected server error",
-				Detail:  fmt.Sprint(r),
-			}
+			response := newErrorResponse(
+				c, "Unexpected server error", fmt.Sprint(r),
+			)
 			statusCode := http.StatusInternalServerError
 
 			c.JSON(statusCode, response)
@@ -67,24 +261,20 @@ func ErrorHandler(c *gin.Context) {
 		var response ErrorResponse
 		var statusCode = 0
 		if ok {
-			base.Logger.WithFields(logrus.Fields{
+			Logger(c).WithFields(logrus.Fields{
 				"detail": parsedError.Detail,
 			}).Error("Error processing request: ", parsedError.Summary)
 
-			response = ErrorResponse{
-				Summary: parsedError.Summary,
-				Detail:  parsedError.Detail,
-			}
+			response = newErrorResponse(
+				c, parsedError.Summary, parsedError.Detail,
+			)
 			statusCode = parsedError.Status
 		} else {
-			base.Logger.WithFields(logrus.Fields{
+			Logger(c).WithFields(logrus.Fields{
 				"detail": err.Error(),
 			}).Error("Error processing request")
 
-			response = ErrorResponse{
-				Summary: err.Error(),
-				Detail:  err.Meta,
-			}
+			response = newErrorResponse(c, err.Error(), err.Meta)
 			statusCode = http.StatusInternalServerError
 		}
 		if statusCode == 0 {
@@ -95,16 +285,39 @@ func ErrorHandler(c *gin.Context) {
 	}
 }
 
+func PermissionHandler(permission base.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil || !user.HasPermission(permission) {
+			c.Error(base.NewPermissionError(permission))
+			c.Abort()
+			return
+		}
+		if !user.CanAccessUser(c.Param(base.UserIdPathParam)) {
+			c.Error(base.ServiceError{
+				Summary: "Access token is not allowed for this user",
+				Status:  http.StatusForbidden,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 func CORSHandler(c *gin.Context) {
 	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 	c.Writer.Header().Set(
 		"Access-Control-Allow-Headers",
 		"Content-Type, Content-Length, Accept-Encoding, Authorization, "+
-			"Content-Disposition")
-	c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
+			"Content-Disposition, Last-Event-ID, X-Request-ID, traceparent")
+	c.Writer.Header().Set(
+		"Access-Control-Expose-Headers", "Content-Disposition, X-Request-ID",
+	)
 	c.Writer.Header().Set(
-		"Access-Control-Allow-Methods", "POST, OPTIONS, GET, DELETE",
+		"Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE",
 	)
 
 	if c.Request.Method == "OPTIONS" {
@@ -1,7 +1,26 @@
 package api
 
+import (
+	"access-backend/base"
+	"slices"
+)
+
 type AdminUser struct {
-	Username string `json:"username"`
+	Username    string            `json:"username"`
+	Role        string            `json:"role"`
+	Permissions []base.Permission `json:"permissions"`
+	TokenId     string            `json:"token_id,omitempty"`
+	UserIds     []string          `json:"user_ids,omitempty"`
+}
+
+func (user *AdminUser) HasPermission(permission base.Permission) bool {
+	return slices.Contains(user.Permissions, permission)
+}
+
+// CanAccessUser reports if caller is not bound to specific users or bound
+// to given user.
+func (user *AdminUser) CanAccessUser(userId string) bool {
+	return len(user.UserIds) == 0 || slices.Contains(user.UserIds, userId)
 }
 
 type User struct {
@@ -1,9 +1,35 @@
 package api
 
+import (
+	"access-backend/base"
+	"time"
+)
+
 type HealthcheckResponse struct {
-	Status string `json:"status" example:"ok"`
+	Status string `json:"status" example:"ok" enums:"ok,unavailable,shutting down"`
 } //@name HealthcheckResponse
 
+type DependencyStatus struct {
+	Status    string  `json:"status" example:"ok" enums:"ok,unavailable"`
+	LatencyMs float64 `json:"latency_ms" example:"3.2"`
+	Error     string  `json:"error,omitempty" example:"connection refused"`
+} //@name DependencyStatus
+
+type ReadinessResponse struct {
+	Status       string                      `json:"status" example:"ok" enums:"ok,unavailable,shutting down"`
+	CheckedAt    time.Time                   `json:"checked_at"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+} //@name ReadinessResponse
+
+type BuildInfoResponse struct {
+	Version      string `json:"version" example:"1.4.0"`
+	GoVersion    string `json:"go_version" example:"go1.21.1"`
+	Module       string `json:"module" example:"access-backend"`
+	Revision     string `json:"revision,omitempty" example:"f3b1827"`
+	RevisionTime string `json:"revision_time,omitempty" example:"2024-01-01T00:00:00Z"`
+	Modified     bool   `json:"modified"`
+} //@name BuildInfoResponse
+
 type AddUserRequest struct {
 	User
 } //@name AddUserRequest
@@ -14,6 +40,7 @@ type UserResponse struct {
 	Email     string `json:"email"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
+	State     string `json:"state" example:"active"`
 } //@name UserResponse
 
 type GetUsersResponse struct {
@@ -23,11 +50,221 @@ type GetUsersResponse struct {
 } //@name GetUsersResponse
 
 type ErrorResponse struct {
-	Summary string `json:"summary" validate:"required" example:"Invalid authorization token"`
-	Detail  any    `json:"detail"`
+	Summary   string `json:"summary" validate:"required" example:"Invalid authorization token"`
+	Detail    any    `json:"detail"`
+	TraceId   string `json:"trace_id,omitempty" example:"4bf92f3577b34da6a3ce929d0e0e4736"`
+	RequestId string `json:"request_id,omitempty" example:"9f2c51e0a4b8d3c7"`
 } //@name ErrorResponse
 
 type PaginationQueryParameters struct {
 	PageToken string `query:"page_token" example:"euKoY1BqY3J8GVax" default:""`
 	Limit     int64  `validate:"gte=1" query:"limit" example:"20" default:"20"`
 } //@name PaginationQueryParameters
+
+type PolicyCaller struct {
+	Name        string            `json:"name" example:"dashboard"`
+	Role        string            `json:"role" example:"viewer"`
+	Permissions []base.Permission `json:"permissions"`
+} //@name PolicyCaller
+
+type PolicyInput struct {
+	Caller *PolicyCaller     `json:"caller"`
+	Route  string            `json:"route" validate:"required" example:"/v1/users/:user_id"`
+	Method string            `json:"method" validate:"required" example:"DELETE"`
+	Params map[string]string `json:"params"`
+	Target map[string]any    `json:"target"`
+} //@name PolicyInput
+
+type PolicyDecision struct {
+	Allowed bool    `json:"allowed" example:"false"`
+	Rule    *string `json:"rule" example:"no-deletes-outside-business-hours"`
+	Message *string `json:"message" example:"Users can be deleted only in business hours"`
+} //@name PolicyDecision
+
+type LogLevelRequest struct {
+	Level string `json:"level" validate:"required,oneof=fatal error warn warning info debug trace" example:"debug"`
+	// Seconds, after which level is reverted to configured one
+	Ttl int64 `json:"ttl" validate:"gte=0" example:"900"`
+} //@name LogLevelRequest
+
+type LogLevelResponse struct {
+	Level        string     `json:"level" example:"debug"`
+	DefaultLevel string     `json:"default_level" example:"info"`
+	RevertAt     *time.Time `json:"revert_at,omitempty"`
+} //@name LogLevelResponse
+
+type TokenRequest struct {
+	Scopes  []base.Permission `json:"scopes" validate:"required,min=1" example:"users:read"`
+	Ttl     int64             `json:"ttl" validate:"gte=0" example:"900"`
+	UserIds []string          `json:"user_ids" example:"6e98ca78-d3ea-4682-adf1-51c12585e7d7"`
+} //@name TokenRequest
+
+type TokenResponse struct {
+	Token     string            `json:"token"`
+	TokenId   string            `json:"token_id" example:"Zk3Jd8sn2Kdlq9Ls"`
+	Scopes    []base.Permission `json:"scopes" example:"users:read"`
+	UserIds   []string          `json:"user_ids" example:"6e98ca78-d3ea-4682-adf1-51c12585e7d7"`
+	ExpiresAt time.Time         `json:"expires_at"`
+} //@name TokenResponse
+
+type RevokeTokenRequest struct {
+	TokenId string `json:"token_id" validate:"required" example:"Zk3Jd8sn2Kdlq9Ls"`
+} //@name RevokeTokenRequest
+
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+} //@name AuditChange
+
+type AuditEvent struct {
+	Id           int64                  `json:"id" example:"42"`
+	Time         time.Time              `json:"time"`
+	Actor        string                 `json:"actor" example:"admin"`
+	Action       string                 `json:"action" example:"user.delete"`
+	TargetUserId string                 `json:"target_user_id" example:"6e98ca78-d3ea-4682-adf1-51c12585e7d7"`
+	RequestId    string                 `json:"request_id" example:"9f2c51e0a4b8d3c7"`
+	ClientIp     string                 `json:"client_ip" example:"10.0.0.12"`
+	Status       int                    `json:"status" example:"204"`
+	Changes      map[string]AuditChange `json:"changes"`
+	Signature    string                 `json:"signature,omitempty"`
+	PrevHash     string                 `json:"prev_hash" example:"5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8"`
+	Hash         string                 `json:"hash" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+} //@name AuditEvent
+
+type AuditQueryParameters struct {
+	Actor     string     `query:"actor" example:"admin"`
+	Target    string     `query:"target" example:"6e98ca78-d3ea-4682-adf1-51c12585e7d7"`
+	Action    string     `query:"action" example:"user.delete"`
+	From      *time.Time `query:"from" example:"2024-01-01T00:00:00Z"`
+	To        *time.Time `query:"to" example:"2024-02-01T00:00:00Z"`
+	PageToken string     `query:"page_token" example:"42" default:""`
+	Limit     int64      `validate:"gte=1" query:"limit" example:"20" default:"20"`
+} //@name AuditQueryParameters
+
+type GetAuditEventsResponse struct {
+	List          []AuditEvent `json:"list"`
+	NextPageToken *string      `json:"next_page_token" example:"42"`
+} //@name GetAuditEventsResponse
+
+type UserEvent struct {
+	Id     string        `json:"id" example:"3f9a2c7d1b8e4f60"`
+	Type   string        `json:"type" example:"user.created"`
+	Time   time.Time     `json:"time"`
+	UserId string        `json:"user_id" example:"6e98ca78-d3ea-4682-adf1-51c12585e7d7"`
+	User   *UserResponse `json:"user"`
+} //@name UserEvent
+
+type WebhookRequest struct {
+	Url    string   `json:"url" validate:"required,url" example:"https://billing.example.com/hooks/users"`
+	Secret string   `json:"secret" validate:"required,min=16" example:"Lk29dkSm3Jd8sn2Kdlq"`
+	Events []string `json:"events" validate:"required,min=1,dive,oneof=user.created user.updated user.deactivated user.deleted" example:"user.created"`
+} //@name WebhookRequest
+
+type WebhookResponse struct {
+	Id     string   `json:"id" example:"billing"`
+	Url    string   `json:"url" example:"https://billing.example.com/hooks/users"`
+	Events []string `json:"events" example:"user.created"`
+	Static bool     `json:"static" example:"false"`
+} //@name WebhookResponse
+
+type WebhookDelivery struct {
+	Id            string    `json:"id" example:"9c1d7e2a5b3f8064"`
+	WebhookId     string    `json:"webhook_id" example:"billing"`
+	Event         UserEvent `json:"event"`
+	Attempts      int       `json:"attempts" example:"8"`
+	LastError     string    `json:"last_error" example:"Unexpected response status 503"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+} //@name WebhookDelivery
+
+type WebhookStatsResponse struct {
+	QueueDepth     int64 `json:"queue_depth" example:"0"`
+	Delivered      int64 `json:"delivered" example:"1250"`
+	FailedAttempts int64 `json:"failed_attempts" example:"12"`
+	DeadLetters    int64 `json:"dead_letters" example:"1"`
+} //@name WebhookStatsResponse
+
+type KratosHookIdentity struct {
+	Id     string         `json:"id" validate:"required"`
+	State  string         `json:"state" example:"active"`
+	Traits map[string]any `json:"traits" validate:"required"`
+} //@name KratosHookIdentity
+
+type KratosHookPayload struct {
+	FlowId    string              `json:"flow_id"`
+	FlowType  string              `json:"flow_type" example:"browser"`
+	ClientIp  string              `json:"client_ip"`
+	UserAgent string              `json:"user_agent"`
+	Identity  *KratosHookIdentity `json:"identity" validate:"required"`
+} //@name KratosHookPayload
+
+type KratosValidationPayload struct {
+	KratosHookPayload
+	// Active method of flow, e.g. "password" or "profile"
+	Method string `json:"method,omitempty" example:"password"`
+	// Password passed by UI in transient_payload, it is validated if set
+	Password string `json:"password,omitempty"`
+} //@name KratosValidationPayload
+
+// KratosHookResponse is parsed by Kratos, identity is not modified if it
+// is not set
+type KratosHookResponse struct {
+	Identity *KratosHookIdentity `json:"identity,omitempty"`
+} //@name KratosHookResponse
+
+type KratosMessage struct {
+	Id      int64          `json:"id" example:"4000001"`
+	Text    string         `json:"text"`
+	Type    string         `json:"type" example:"error"`
+	Context map[string]any `json:"context,omitempty"`
+} //@name KratosMessage
+
+type KratosFieldMessages struct {
+	InstancePtr string          `json:"instance_ptr" example:"#/traits/username"`
+	Messages    []KratosMessage `json:"messages"`
+} //@name KratosFieldMessages
+
+// KratosErrorResponse is shown by Kratos as messages of form fields
+type KratosErrorResponse struct {
+	Messages []KratosFieldMessages `json:"messages"`
+} //@name KratosErrorResponse
+
+// UserVersion is a state of identity traits and metadata after change.
+// Changes contain differences with the previous version by field path,
+// e.g. "traits.email" or "state".
+type UserVersion struct {
+	UserId         string                 `json:"user_id"`
+	Version        int64                  `json:"version" example:"3"`
+	Time           time.Time              `json:"time"`
+	Actor          string                 `json:"actor" example:"admin"`
+	Source         string                 `json:"source" example:"api" enums:"api,kratos_hook,reconciler,restore,baseline"`
+	State          string                 `json:"state" example:"active"`
+	Traits         map[string]any         `json:"traits"`
+	MetadataPublic any                    `json:"metadata_public"`
+	MetadataAdmin  any                    `json:"metadata_admin"`
+	Changes        map[string]AuditChange `json:"changes"`
+} //@name UserVersion
+
+type GetUserHistoryResponse struct {
+	List []UserVersion `json:"list"`
+} //@name GetUserHistoryResponse
+
+type DeletionStep struct {
+	Name        string     `json:"name" example:"files"`
+	State       string     `json:"state" example:"done" enums:"pending,done,failed,skipped"`
+	Attempts    int        `json:"attempts" example:"1"`
+	LastError   string     `json:"last_error,omitempty" example:"Unexpected response status 503"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+} //@name DeletionStep
+
+// DeletionStatusResponse is a state of user deletion saga. Downstream
+// steps are executed in order, Kratos identity is deleted by the last
+// "kratos" step.
+type DeletionStatusResponse struct {
+	UserId    string         `json:"user_id"`
+	State     string         `json:"state" example:"running" enums:"running,failed,completed"`
+	Actor     string         `json:"actor" example:"admin"`
+	Forced    bool           `json:"forced"`
+	Steps     []DeletionStep `json:"steps"`
+	StartedAt time.Time      `json:"started_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+} //@name DeletionStatusResponse
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"access-backend/base"
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AttemptsStore keeps failed authentication attempts counters and lockouts
+// by key. Counters expire after given TTL since the last failure.
+type AttemptsStore interface {
+	LockedUntil(key string) (time.Time, error)
+	AddFailure(key string, ttl time.Duration) (int64, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+	// Ping checks that store is reachable
+	Ping(ctx context.Context) error
+}
+
+type attemptsEntry struct {
+	failures    int64
+	expiresAt   time.Time
+	lockedUntil time.Time
+}
+
+type MemoryAttemptsStore struct {
+	AttemptsStore
+	mutex     sync.Mutex
+	entries   map[string]*attemptsEntry
+	lastSweep time.Time
+}
+
+func NewMemoryAttemptsStore() *MemoryAttemptsStore {
+	return &MemoryAttemptsStore{entries: map[string]*attemptsEntry{}}
+}
+
+func (store *MemoryAttemptsStore) sweep(now time.Time) {
+	if now.Sub(store.lastSweep) < time.Minute {
+		return
+	}
+	for key, entry := range store.entries {
+		if now.After(entry.expiresAt) && now.After(entry.lockedUntil) {
+			delete(store.entries, key)
+		}
+	}
+	store.lastSweep = now
+}
+
+func (store *MemoryAttemptsStore) LockedUntil(key string) (time.Time, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if entry, ok := store.entries[key]; ok {
+		return entry.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (store *MemoryAttemptsStore) AddFailure(key string, ttl time.Duration) (
+	int64, error,
+) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	store.sweep(now)
+	entry, ok := store.entries[key]
+	if !ok {
+		entry = &attemptsEntry{}
+		store.entries[key] = entry
+	}
+	if now.After(entry.expiresAt) {
+		entry.failures = 0
+	}
+	entry.failures++
+	entry.expiresAt = now.Add(ttl)
+	return entry.failures, nil
+}
+
+func (store *MemoryAttemptsStore) Lock(key string, until time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if entry, ok := store.entries[key]; ok {
+		entry.lockedUntil = until
+	} else {
+		store.entries[key] = &attemptsEntry{lockedUntil: until}
+	}
+	return nil
+}
+
+func (store *MemoryAttemptsStore) Reset(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.entries, key)
+	return nil
+}
+
+func (store *MemoryAttemptsStore) Ping(context.Context) error {
+	return nil
+}
+
+// RedisAttemptsStore shares attempts counters between service instances
+// using any Redis protocol compatible server.
+type RedisAttemptsStore struct {
+	AttemptsStore
+	Client    *redis.Client
+	KeyPrefix string
+	Context   *context.Context
+}
+
+func NewRedisAttemptsStore(
+	config *base.RedisConfig, ctx *context.Context,
+) *RedisAttemptsStore {
+	return &RedisAttemptsStore{
+		Client: redis.NewClient(&redis.Options{
+			Addr:     config.Address,
+			Password: config.Password,
+			DB:       config.Database,
+		}),
+		KeyPrefix: config.KeyPrefix,
+		Context:   ctx,
+	}
+}
+
+func (store *RedisAttemptsStore) failuresKey(key string) string {
+	return store.KeyPrefix + "attempts:" + key
+}
+
+func (store *RedisAttemptsStore) lockKey(key string) string {
+	return store.KeyPrefix + "lock:" + key
+}
+
+func (store *RedisAttemptsStore) LockedUntil(key string) (time.Time, error) {
+	value, err := store.Client.Get(*store.Context, store.lockKey(key)).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(timestamp), nil
+}
+
+func (store *RedisAttemptsStore) AddFailure(key string, ttl time.Duration) (
+	int64, error,
+) {
+	pipeline := store.Client.TxPipeline()
+	failures := pipeline.Incr(*store.Context, store.failuresKey(key))
+	pipeline.Expire(*store.Context, store.failuresKey(key), ttl)
+	if _, err := pipeline.Exec(*store.Context); err != nil {
+		return 0, err
+	}
+	return failures.Val(), nil
+}
+
+func (store *RedisAttemptsStore) Lock(key string, until time.Time) error {
+	return store.Client.Set(
+		*store.Context,
+		store.lockKey(key),
+		strconv.FormatInt(until.UnixMilli(), 10),
+		time.Until(until),
+	).Err()
+}
+
+func (store *RedisAttemptsStore) Reset(key string) error {
+	return store.Client.Del(
+		*store.Context, store.failuresKey(key), store.lockKey(key),
+	).Err()
+}
+
+func (store *RedisAttemptsStore) Ping(ctx context.Context) error {
+	return store.Client.Ping(ctx).Err()
+}
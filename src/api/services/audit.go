@@ -0,0 +1,377 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const redactedValue string = "[REDACTED]"
+
+type BaseAuditService interface {
+	Record(event *api.AuditEvent, before any, after any)
+	Query(params *api.AuditQueryParameters) (*api.GetAuditEventsResponse, error)
+}
+
+type AuditService struct {
+	BaseAuditService
+	AuditConfig *base.AuditConfig
+	Sink        AuditSink
+	// CheckpointKey signs checkpoint events, checkpoints are not written
+	// if it is nil
+	CheckpointKey ed25519.PrivateKey
+	// VerifyKey verifies checkpoint signatures, it is public part of
+	// CheckpointKey or configured public key
+	VerifyKey      ed25519.PublicKey
+	mutex          sync.Mutex
+	uncheckpointed int64
+}
+
+// AuditVerification is a result of walking audit events chain. Legacy
+// events written before hash chaining are counted, but not verified.
+// BrokenId is id of the first event failed verification, Reason describes
+// failure.
+type AuditVerification struct {
+	Legacy      int64
+	Events      int64
+	Checkpoints int64
+	BrokenId    int64
+	Reason      string
+}
+
+// ParseCheckpointKey decodes base64 Ed25519 seed or private key.
+func ParseCheckpointKey(encoded string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit checkpoint key. %s", err.Error())
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return key, nil
+	}
+	return nil, fmt.Errorf(
+		"invalid audit checkpoint key length %d, expected %d or %d bytes",
+		len(key),
+		ed25519.SeedSize,
+		ed25519.PrivateKeySize,
+	)
+}
+
+// ParseCheckpointPublicKey decodes base64 Ed25519 public key.
+func ParseCheckpointPublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid audit checkpoint public key. %s", err.Error(),
+		)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf(
+			"invalid audit checkpoint public key length %d, expected %d bytes",
+			len(key),
+			ed25519.PublicKeySize,
+		)
+	}
+	return key, nil
+}
+
+func checkpointMessage(id int64, prevHash string) []byte {
+	return []byte(strconv.FormatInt(id, 10) + ":" + prevHash)
+}
+
+func (service *AuditService) seal(
+	event *api.AuditEvent, id int64, prevHash string,
+) error {
+	if prevHash == "" && id > 1 && event.Action != base.GenesisAction {
+		return errors.New("audit chain has no genesis event after legacy events")
+	}
+	event.Id = id
+	event.PrevHash = prevHash
+	if event.Action == base.CheckpointAction {
+		event.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(
+			service.CheckpointKey, checkpointMessage(id, prevHash),
+		))
+	}
+	hash, err := AuditEventHash(event)
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+	return nil
+}
+
+func toFields(value any) map[string]any {
+	fields := map[string]any{}
+	reflected := reflect.ValueOf(value)
+	if value == nil || (reflected.Kind() == reflect.Pointer && reflected.IsNil()) {
+		return fields
+	}
+	content, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(content, &fields)
+	}
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Warn("Error converting audit value")
+	}
+	return fields
+}
+
+// diff returns changed fields of two JSON serializable values with
+// configured fields redacted.
+func (service *AuditService) diff(before any, after any) map[string]api.AuditChange {
+	beforeFields := toFields(before)
+	afterFields := toFields(after)
+
+	changes := map[string]api.AuditChange{}
+	addChange := func(name string) {
+		beforeValue, afterValue := beforeFields[name], afterFields[name]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			return
+		}
+		if slices.Contains(service.AuditConfig.RedactFields, name) {
+			if beforeValue != nil {
+				beforeValue = redactedValue
+			}
+			if afterValue != nil {
+				afterValue = redactedValue
+			}
+		}
+		changes[name] = api.AuditChange{Before: beforeValue, After: afterValue}
+	}
+	for name := range beforeFields {
+		addChange(name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			addChange(name)
+		}
+	}
+	return changes
+}
+
+// Record stores audit event with redacted diff of before and after
+// values. Storage errors are logged, so they never fail audited operation.
+func (service *AuditService) Record(event *api.AuditEvent, before any, after any) {
+	event.Time = time.Now().UTC().Truncate(time.Microsecond)
+	event.Changes = service.diff(before, after)
+
+	if err := service.Sink.Append(event, service.seal); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error":  err.Error(),
+			"action": event.Action,
+			"actor":  event.Actor,
+			"target": event.TargetUserId,
+		}).Error("Error recording audit event")
+		return
+	}
+	service.mutex.Lock()
+	service.uncheckpointed++
+	service.mutex.Unlock()
+}
+
+func (service *AuditService) writeCheckpoint() {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if service.uncheckpointed == 0 {
+		return
+	}
+
+	event := api.AuditEvent{
+		Time:    time.Now().UTC().Truncate(time.Microsecond),
+		Actor:   "system",
+		Action:  base.CheckpointAction,
+		Changes: map[string]api.AuditChange{},
+	}
+	if err := service.Sink.Append(&event, service.seal); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Error writing audit checkpoint")
+		return
+	}
+	service.uncheckpointed = 0
+	base.Logger.WithFields(logrus.Fields{
+		"id":   event.Id,
+		"hash": event.Hash,
+	}).Info("Audit checkpoint written")
+}
+
+// errChainStarted stops appending genesis event to started chain.
+var errChainStarted = errors.New("audit chain is started")
+
+// StartChain appends genesis event, if audit log contains only legacy
+// events written before hash chaining, so chain starts after them.
+func (service *AuditService) StartChain() error {
+	event := api.AuditEvent{
+		Time:    time.Now().UTC().Truncate(time.Microsecond),
+		Actor:   "system",
+		Action:  base.GenesisAction,
+		Changes: map[string]api.AuditChange{},
+	}
+	err := service.Sink.Append(
+		&event,
+		func(event *api.AuditEvent, id int64, prevHash string) error {
+			if prevHash != "" || id == 1 {
+				return errChainStarted
+			}
+			event.Changes["legacy_events"] = api.AuditChange{After: id - 1}
+			return service.seal(event, id, prevHash)
+		},
+	)
+	if errors.Is(err, errChainStarted) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("audit genesis event writing error. %s", err.Error())
+	}
+	base.Logger.WithFields(logrus.Fields{
+		"id":            event.Id,
+		"legacy_events": event.Id - 1,
+	}).Warn("Audit chain started after legacy events")
+	return nil
+}
+
+// RunCheckpoints periodically appends checkpoint events signed with
+// checkpoint key, if there are new events since the last checkpoint.
+func (service *AuditService) RunCheckpoints(ctx context.Context) {
+	ticker := time.NewTicker(service.AuditConfig.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.writeCheckpoint()
+		}
+	}
+}
+
+// genesisLegacyEvents returns number of legacy events recorded by genesis
+// event. Decoded JSON numbers are float64.
+func genesisLegacyEvents(event *api.AuditEvent) (int64, bool) {
+	switch count := event.Changes["legacy_events"].After.(type) {
+	case int64:
+		return count, true
+	case float64:
+		return int64(count), true
+	default:
+		return 0, false
+	}
+}
+
+func (service *AuditService) verifyEvent(
+	event *api.AuditEvent, prevId int64, prevHash string, legacy int64,
+) string {
+	if event.Id != prevId+1 {
+		return fmt.Sprintf("expected event id %d", prevId+1)
+	}
+	if event.Action == base.GenesisAction && prevId > 0 && prevHash != "" {
+		return "genesis event inside chain"
+	}
+	if event.Action != base.GenesisAction && prevId > 0 && prevHash == "" {
+		return "chain after legacy events does not start with genesis event"
+	}
+	if event.PrevHash != prevHash {
+		return "previous hash does not match previous event hash"
+	}
+	hash, err := AuditEventHash(event)
+	if err != nil {
+		return err.Error()
+	}
+	if hash != event.Hash {
+		return "event hash does not match event content"
+	}
+	if event.Action == base.GenesisAction {
+		if count, ok := genesisLegacyEvents(event); !ok || count != legacy {
+			return fmt.Sprintf(
+				"genesis event legacy events count does not match %d read events",
+				legacy,
+			)
+		}
+	}
+	if event.Action != base.CheckpointAction {
+		return ""
+	}
+	if service.VerifyKey == nil {
+		return "checkpoint public key is not configured"
+	}
+	signature, err := base64.StdEncoding.DecodeString(event.Signature)
+	if err != nil || !ed25519.Verify(
+		service.VerifyKey, checkpointMessage(event.Id, event.PrevHash), signature,
+	) {
+		return "invalid checkpoint signature"
+	}
+	return ""
+}
+
+// Verify walks audit events chain and stops at the first broken link.
+// Events without hash at the beginning of log are legacy ones, chain after
+// them must start with genesis event, which records number of them.
+func (service *AuditService) Verify() (*AuditVerification, error) {
+	result := AuditVerification{}
+	var prevId int64
+	var prevHash string
+	errBroken := errors.New("audit chain is broken")
+
+	err := service.Sink.Walk(func(event *api.AuditEvent) error {
+		if event.Hash == "" && event.Id == prevId+1 && result.Events == 0 {
+			result.Legacy++
+			prevId = event.Id
+			return nil
+		}
+		reason := service.verifyEvent(event, prevId, prevHash, result.Legacy)
+		if reason != "" {
+			result.BrokenId = event.Id
+			result.Reason = reason
+			return errBroken
+		}
+		result.Events++
+		if event.Action == base.CheckpointAction {
+			result.Checkpoints++
+		}
+		prevId = event.Id
+		prevHash = event.Hash
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBroken) {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (service *AuditService) Query(params *api.AuditQueryParameters) (
+	*api.GetAuditEventsResponse, error,
+) {
+	events, err := service.Sink.Query(params)
+	if err != nil {
+		return nil, base.ServiceError{
+			Summary: "Error retrieving audit events",
+			Detail:  err.Error(),
+			Status:  http.StatusInternalServerError,
+		}
+	}
+
+	result := api.GetAuditEventsResponse{List: events}
+	if int64(len(events)) > params.Limit {
+		result.List = events[:params.Limit]
+		nextToken := strconv.FormatInt(result.List[params.Limit-1].Id, 10)
+		result.NextPageToken = &nextToken
+	}
+	return &result, nil
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"access-backend/api"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	_ "github.com/lib/pq"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AuditSealFunc assigns event id, links event to the previous one by its
+// hash and computes event hash.
+type AuditSealFunc func(event *api.AuditEvent, id int64, prevHash string) error
+
+// AuditSink stores hash-chained audit events. Append seals event with id
+// and hash following the last stored event atomically. Query returns events matching params
+// with id greater than params page token, ordered by id, at most
+// params limit + 1 events, so caller can detect next page. Walk iterates
+// over all events ordered by id.
+type AuditSink interface {
+	Append(event *api.AuditEvent, seal AuditSealFunc) error
+	Query(params *api.AuditQueryParameters) ([]api.AuditEvent, error)
+	Walk(handle func(event *api.AuditEvent) error) error
+	// Ping checks that storage is reachable
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// AuditEventHash returns hex SHA-256 of event JSON without its own hash.
+// Event JSON includes hash of the previous event, so any modification of
+// stored event breaks the chain.
+func AuditEventHash(event *api.AuditEvent) (string, error) {
+	unsealed := *event
+	unsealed.Hash = ""
+	content, err := json.Marshal(&unsealed)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func parseAuditPageToken(params *api.AuditQueryParameters) (int64, error) {
+	if params.PageToken == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(params.PageToken, 10, 64)
+}
+
+func auditEventMatches(
+	event *api.AuditEvent, params *api.AuditQueryParameters, afterId int64,
+) bool {
+	return event.Id > afterId &&
+		(params.Actor == "" || event.Actor == params.Actor) &&
+		(params.Target == "" || event.TargetUserId == params.Target) &&
+		(params.Action == "" || event.Action == params.Action) &&
+		(params.From == nil || !event.Time.Before(*params.From)) &&
+		(params.To == nil || event.Time.Before(*params.To))
+}
+
+// FileAuditSink appends audit events to file as JSON lines. File is never
+// rewritten, queries scan the whole file.
+type FileAuditSink struct {
+	AuditSink
+	mutex    sync.Mutex
+	file     *os.File
+	lastId   int64
+	lastHash string
+}
+
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"audit file '%s' open error. %s", path, err.Error(),
+		)
+	}
+
+	sink := &FileAuditSink{file: file}
+	err = sink.scan(func(event *api.AuditEvent) bool {
+		sink.lastId = event.Id
+		sink.lastHash = event.Hash
+		return true
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf(
+			"audit file '%s' reading error, invalid format. %s",
+			path,
+			err.Error(),
+		)
+	}
+	return sink, nil
+}
+
+func (sink *FileAuditSink) scan(handle func(event *api.AuditEvent) bool) error {
+	if _, err := sink.file.Seek(0, 0); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(sink.file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var event api.AuditEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			return err
+		}
+		if !handle(&event) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+func (sink *FileAuditSink) Append(
+	event *api.AuditEvent, seal AuditSealFunc,
+) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if err := seal(event, sink.lastId+1, sink.lastHash); err != nil {
+		return err
+	}
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err = sink.file.Write(append(content, '\n')); err != nil {
+		return err
+	}
+	if err = sink.file.Sync(); err != nil {
+		return err
+	}
+	sink.lastId = event.Id
+	sink.lastHash = event.Hash
+	return nil
+}
+
+func (sink *FileAuditSink) Query(params *api.AuditQueryParameters) (
+	[]api.AuditEvent, error,
+) {
+	afterId, err := parseAuditPageToken(params)
+	if err != nil {
+		return nil, err
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	events := make([]api.AuditEvent, 0)
+	err = sink.scan(func(event *api.AuditEvent) bool {
+		if auditEventMatches(event, params, afterId) {
+			events = append(events, *event)
+		}
+		return int64(len(events)) <= params.Limit
+	})
+	return events, err
+}
+
+func (sink *FileAuditSink) Walk(handle func(event *api.AuditEvent) error) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	var handleErr error
+	err := sink.scan(func(event *api.AuditEvent) bool {
+		handleErr = handle(event)
+		return handleErr == nil
+	})
+	if handleErr != nil {
+		return handleErr
+	}
+	return err
+}
+
+func (sink *FileAuditSink) Ping(context.Context) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	_, err := sink.file.Stat()
+	return err
+}
+
+func (sink *FileAuditSink) Close() error {
+	return sink.file.Close()
+}
+
+// PostgresAuditSink stores audit events in PostgreSQL table, which is
+// created on start if it does not exist.
+type PostgresAuditSink struct {
+	AuditSink
+	db *sql.DB
+}
+
+func NewPostgresAuditSink(dsn string) (*PostgresAuditSink, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("audit database open error. %s", err.Error())
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS audit_events (
+		id BIGSERIAL PRIMARY KEY,
+		time TIMESTAMPTZ NOT NULL,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_user_id TEXT NOT NULL,
+		request_id TEXT NOT NULL,
+		client_ip TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		changes JSONB
+	);
+	ALTER TABLE audit_events
+		ADD COLUMN IF NOT EXISTS signature TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS prev_hash TEXT NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS hash TEXT NOT NULL DEFAULT ''`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("audit table creation error. %s", err.Error())
+	}
+	return &PostgresAuditSink{db: db}, nil
+}
+
+const auditColumns string = `id, time, actor, action, target_user_id,
+	request_id, client_ip, status, changes, signature, prev_hash, hash`
+
+// auditChainLockId is PostgreSQL advisory lock key, which serializes
+// appending events by all service instances.
+const auditChainLockId int64 = 7216541901
+
+func scanAuditEvent(rows *sql.Rows) (*api.AuditEvent, error) {
+	var event api.AuditEvent
+	var changes []byte
+	if err := rows.Scan(
+		&event.Id,
+		&event.Time,
+		&event.Actor,
+		&event.Action,
+		&event.TargetUserId,
+		&event.RequestId,
+		&event.ClientIp,
+		&event.Status,
+		&changes,
+		&event.Signature,
+		&event.PrevHash,
+		&event.Hash,
+	); err != nil {
+		return nil, err
+	}
+	event.Time = event.Time.UTC()
+	if err := json.Unmarshal(changes, &event.Changes); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (sink *PostgresAuditSink) Append(
+	event *api.AuditEvent, seal AuditSealFunc,
+) error {
+	transaction, err := sink.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+
+	if _, err = transaction.Exec(
+		"SELECT pg_advisory_xact_lock($1)", auditChainLockId,
+	); err != nil {
+		return err
+	}
+	var lastId int64
+	var lastHash string
+	err = transaction.QueryRow(
+		"SELECT id, hash FROM audit_events ORDER BY id DESC LIMIT 1",
+	).Scan(&lastId, &lastHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err = seal(event, lastId+1, lastHash); err != nil {
+		return err
+	}
+	changes, err := json.Marshal(event.Changes)
+	if err != nil {
+		return err
+	}
+
+	if _, err = transaction.Exec(
+		`INSERT INTO audit_events (`+auditColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		event.Id,
+		event.Time,
+		event.Actor,
+		event.Action,
+		event.TargetUserId,
+		event.RequestId,
+		event.ClientIp,
+		event.Status,
+		changes,
+		event.Signature,
+		event.PrevHash,
+		event.Hash,
+	); err != nil {
+		return err
+	}
+	return transaction.Commit()
+}
+
+func (sink *PostgresAuditSink) Query(params *api.AuditQueryParameters) (
+	[]api.AuditEvent, error,
+) {
+	afterId, err := parseAuditPageToken(params)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"id > $1"}
+	args := []any{afterId}
+	addCondition := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(
+			conditions, fmt.Sprintf(condition, len(args)),
+		)
+	}
+	if params.Actor != "" {
+		addCondition("actor = $%d", params.Actor)
+	}
+	if params.Target != "" {
+		addCondition("target_user_id = $%d", params.Target)
+	}
+	if params.Action != "" {
+		addCondition("action = $%d", params.Action)
+	}
+	if params.From != nil {
+		addCondition("time >= $%d", *params.From)
+	}
+	if params.To != nil {
+		addCondition("time < $%d", *params.To)
+	}
+	args = append(args, params.Limit+1)
+
+	rows, err := sink.db.Query(
+		`SELECT `+auditColumns+` FROM audit_events WHERE `+
+			strings.Join(conditions, " AND ")+
+			fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]api.AuditEvent, 0)
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+func (sink *PostgresAuditSink) Walk(
+	handle func(event *api.AuditEvent) error,
+) error {
+	rows, err := sink.db.Query(
+		`SELECT ` + auditColumns + ` FROM audit_events ORDER BY id`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err = handle(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (sink *PostgresAuditSink) Ping(ctx context.Context) error {
+	return sink.db.PingContext(ctx)
+}
+
+func (sink *PostgresAuditSink) Close() error {
+	return sink.db.Close()
+}
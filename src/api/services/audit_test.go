@@ -0,0 +1,243 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAuditService(t *testing.T, path string) *AuditService {
+	sink, err := NewFileAuditSink(path)
+	if err != nil {
+		t.Fatalf("audit sink error: %s", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	return &AuditService{
+		AuditConfig:   &base.AuditConfig{},
+		Sink:          sink,
+		CheckpointKey: key,
+		VerifyKey:     key.Public().(ed25519.PublicKey),
+	}
+}
+
+func recordTestEvents(service *AuditService, count int) {
+	for i := 0; i < count; i++ {
+		service.Record(
+			&api.AuditEvent{Actor: "admin", Action: base.CreateUserAction},
+			nil,
+			map[string]any{"username": "john"},
+		)
+	}
+}
+
+// rewriteAuditLine replaces event of audit file line with modified one.
+func rewriteAuditLine(
+	t *testing.T, path string, line int, modify func(event *api.AuditEvent),
+) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	var event api.AuditEvent
+	if err = json.Unmarshal([]byte(lines[line]), &event); err != nil {
+		t.Fatal(err)
+	}
+	modify(&event)
+	modified, _ := json.Marshal(&event)
+	lines[line] = string(modified)
+	err = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeLegacyEvents(t *testing.T, path string, count int) {
+	var content []byte
+	for i := 1; i <= count; i++ {
+		event, _ := json.Marshal(&api.AuditEvent{
+			Id:     int64(i),
+			Time:   time.Now().UTC(),
+			Actor:  "admin",
+			Action: base.DeleteUserAction,
+		})
+		content = append(append(content, event...), '\n')
+	}
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditVerify(t *testing.T) {
+	tests := []struct {
+		name        string
+		legacy      int
+		prepare     func(t *testing.T, service *AuditService, path string)
+		events      int64
+		checkpoints int64
+		brokenId    int64
+	}{
+		{
+			name:        "valid chain",
+			events:      4,
+			checkpoints: 1,
+		},
+		{
+			name: "modified event",
+			prepare: func(t *testing.T, service *AuditService, path string) {
+				rewriteAuditLine(t, path, 1, func(event *api.AuditEvent) {
+					event.Actor = "intruder"
+				})
+			},
+			events:   1,
+			brokenId: 2,
+		},
+		{
+			name: "rehashed modified event",
+			prepare: func(t *testing.T, service *AuditService, path string) {
+				rewriteAuditLine(t, path, 1, func(event *api.AuditEvent) {
+					event.Actor = "intruder"
+					event.Hash, _ = AuditEventHash(event)
+				})
+			},
+			events:   2,
+			brokenId: 3,
+		},
+		{
+			name: "forged checkpoint",
+			prepare: func(t *testing.T, service *AuditService, path string) {
+				forger := &AuditService{CheckpointKey: ed25519.NewKeyFromSeed(
+					bytes.Repeat([]byte{1}, ed25519.SeedSize),
+				)}
+				rewriteAuditLine(t, path, 3, func(event *api.AuditEvent) {
+					forger.seal(event, event.Id, event.PrevHash)
+				})
+			},
+			events:   3,
+			brokenId: 4,
+		},
+		{
+			name: "missing public key",
+			prepare: func(t *testing.T, service *AuditService, path string) {
+				service.VerifyKey = nil
+			},
+			events:   3,
+			brokenId: 4,
+		},
+		{
+			name: "public key only",
+			prepare: func(t *testing.T, service *AuditService, path string) {
+				service.CheckpointKey = nil
+			},
+			events:      4,
+			checkpoints: 1,
+		},
+		{
+			name:        "legacy events",
+			legacy:      2,
+			events:      5,
+			checkpoints: 1,
+		},
+		{
+			name:   "legacy events without genesis",
+			legacy: 2,
+			prepare: func(t *testing.T, service *AuditService, path string) {
+				rewriteAuditLine(t, path, 2, func(event *api.AuditEvent) {
+					event.Action = base.CreateUserAction
+					event.Hash, _ = AuditEventHash(event)
+				})
+			},
+			brokenId: 3,
+		},
+		{
+			name:   "legacy events count mismatch",
+			legacy: 2,
+			prepare: func(t *testing.T, service *AuditService, path string) {
+				// chain is resealed after genesis event change
+				prevHash := ""
+				for line := 2; line < 7; line++ {
+					rewriteAuditLine(t, path, line, func(event *api.AuditEvent) {
+						if event.Action == base.GenesisAction {
+							event.Changes["legacy_events"] = api.AuditChange{After: 3}
+						}
+						service.seal(event, event.Id, prevHash)
+						prevHash = event.Hash
+					})
+				}
+			},
+			brokenId: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			writeLegacyEvents(t, path, test.legacy)
+			service := newTestAuditService(t, path)
+			if err := service.StartChain(); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			recordTestEvents(service, 3)
+			service.writeCheckpoint()
+			service.Sink.Close()
+			if test.prepare != nil {
+				test.prepare(t, service, path)
+			}
+
+			service.Sink = newTestAuditService(t, path).Sink
+			result, err := service.Verify()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if result.Legacy != int64(test.legacy) {
+				t.Errorf("expected %d legacy events, got %d", test.legacy, result.Legacy)
+			}
+			if result.BrokenId != test.brokenId {
+				t.Errorf(
+					"expected broken id %d, got %d (%s)",
+					test.brokenId, result.BrokenId, result.Reason,
+				)
+			}
+			if result.Events != test.events || result.Checkpoints != test.checkpoints {
+				t.Errorf(
+					"expected %d events and %d checkpoints, got %d and %d",
+					test.events, test.checkpoints, result.Events, result.Checkpoints,
+				)
+			}
+		})
+	}
+}
+
+func TestAuditStartChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeLegacyEvents(t, path, 2)
+	service := newTestAuditService(t, path)
+
+	// events after legacy ones are not chained without genesis event
+	recordTestEvents(service, 1)
+	if service.uncheckpointed != 0 {
+		t.Fatal("event is recorded without genesis event")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := service.StartChain(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	recordTestEvents(service, 1)
+	result, err := service.Verify()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result.BrokenId != 0 || result.Legacy != 2 || result.Events != 2 {
+		t.Errorf("expected single genesis event, got %+v", result)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"access-backend/api"
 	"access-backend/base"
+	"crypto/subtle"
 	"net/http"
 )
 
@@ -15,15 +16,35 @@ type AuthService struct {
 	AuthConfig *base.AuthorizationConfig
 }
 
+func tokensEqual(first string, second string) bool {
+	return subtle.ConstantTimeCompare([]byte(first), []byte(second)) == 1
+}
+
+func newAdminUser(
+	config *base.AuthorizationConfig, name string, role string,
+) *api.AdminUser {
+	return &api.AdminUser{
+		Username:    name,
+		Role:        role,
+		Permissions: config.Roles[role],
+	}
+}
+
 func (service AuthService) ParseToken(tokenString string) (*api.AdminUser, error) {
-	if tokenString != service.AuthConfig.AccessToken {
-		return nil, base.ServiceError{
-			Summary: "Invalid token",
-			Status:  http.StatusForbidden,
+	if service.AuthConfig.AccessToken != "" &&
+		tokensEqual(tokenString, service.AuthConfig.AccessToken) {
+		return newAdminUser(
+			service.AuthConfig, "admin", service.AuthConfig.AccessTokenRole,
+		), nil
+	}
+	for _, token := range service.AuthConfig.Tokens {
+		if tokensEqual(tokenString, token.Token) {
+			return newAdminUser(service.AuthConfig, token.Name, token.Role), nil
 		}
 	}
 
-	return &api.AdminUser{
-		Username: "admin",
-	}, nil
+	return nil, base.ServiceError{
+		Summary: "Invalid token",
+		Status:  http.StatusForbidden,
+	}
 }
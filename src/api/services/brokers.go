@@ -0,0 +1,177 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"io"
+	"os"
+	"sync"
+)
+
+const BrokerEventIdHeader string = "Event-Id"
+const BrokerEventTypeHeader string = "Event-Type"
+
+// Broker publishes user events to message broker. Publish returns after
+// broker acknowledged the event, so event is redelivered if it fails.
+// Events of the same user are published with user id as message key.
+type Broker interface {
+	Publish(ctx context.Context, event *api.UserEvent) error
+	Close() error
+}
+
+func CreateBroker(config *base.OutboxConfig) (Broker, error) {
+	switch config.Broker {
+	case "nats":
+		return NewNatsBroker(config)
+	case "kafka":
+		return NewKafkaBroker(config), nil
+	case "file":
+		file, err := os.OpenFile(
+			config.BrokerFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600,
+		)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"broker file '%s' open error. %s", config.BrokerFile, err.Error(),
+			)
+		}
+		return &WriterBroker{Subject: config.Subject, Writer: file}, nil
+	default:
+		return &WriterBroker{Subject: config.Subject, Writer: os.Stdout}, nil
+	}
+}
+
+// NatsBroker publishes events to NATS subject. With JetStream enabled
+// publishing waits for stream acknowledgement and event id is used as
+// message id for deduplication, otherwise it waits for server flush.
+type NatsBroker struct {
+	Subject   string
+	conn      *nats.Conn
+	jetStream nats.JetStreamContext
+}
+
+func NewNatsBroker(config *base.OutboxConfig) (*NatsBroker, error) {
+	conn, err := nats.Connect(
+		config.NatsUrl, nats.MaxReconnects(-1), nats.RetryOnFailedConnect(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("NATS connection error. %s", err.Error())
+	}
+	broker := &NatsBroker{Subject: config.Subject, conn: conn}
+	if config.NatsJetStream {
+		if broker.jetStream, err = conn.JetStream(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("NATS JetStream error. %s", err.Error())
+		}
+	}
+	return broker, nil
+}
+
+func (broker *NatsBroker) Publish(ctx context.Context, event *api.UserEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	message := nats.NewMsg(broker.Subject)
+	message.Data = data
+	message.Header.Set(nats.MsgIdHdr, event.Id)
+	message.Header.Set(BrokerEventIdHeader, event.Id)
+	message.Header.Set(BrokerEventTypeHeader, event.Type)
+
+	if broker.jetStream != nil {
+		_, err = broker.jetStream.PublishMsg(message, nats.Context(ctx))
+		return err
+	}
+	if err = broker.conn.PublishMsg(message); err != nil {
+		return err
+	}
+	return broker.conn.FlushWithContext(ctx)
+}
+
+func (broker *NatsBroker) Close() error {
+	if err := broker.conn.Drain(); err != nil {
+		broker.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// KafkaBroker publishes events to Kafka topic keyed by user id, so events
+// of one user are stored in one partition. Publishing waits for all
+// in-sync replicas.
+type KafkaBroker struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaBroker(config *base.OutboxConfig) *KafkaBroker {
+	return &KafkaBroker{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(config.KafkaBrokers...),
+			Topic:        config.Subject,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  1,
+		},
+	}
+}
+
+func (broker *KafkaBroker) Publish(ctx context.Context, event *api.UserEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return broker.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.UserId),
+		Value: data,
+		Time:  event.Time,
+		Headers: []kafka.Header{
+			{Key: BrokerEventIdHeader, Value: []byte(event.Id)},
+			{Key: BrokerEventTypeHeader, Value: []byte(event.Type)},
+		},
+	})
+}
+
+func (broker *KafkaBroker) Close() error {
+	return broker.writer.Close()
+}
+
+type writerBrokerMessage struct {
+	Subject string         `json:"subject"`
+	Key     string         `json:"key"`
+	Event   *api.UserEvent `json:"event"`
+}
+
+// WriterBroker writes events as JSON lines to file or stdout. It is
+// intended for development.
+type WriterBroker struct {
+	Subject string
+	Writer  io.Writer
+	mutex   sync.Mutex
+}
+
+func (broker *WriterBroker) Publish(_ context.Context, event *api.UserEvent) error {
+	content, err := json.Marshal(writerBrokerMessage{
+		Subject: broker.Subject,
+		Key:     event.UserId,
+		Event:   event,
+	})
+	if err != nil {
+		return err
+	}
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	_, err = broker.Writer.Write(append(content, '\n'))
+	return err
+}
+
+func (broker *WriterBroker) Close() error {
+	if closer, ok := broker.Writer.(io.Closer); ok && broker.Writer != os.Stdout {
+		return closer.Close()
+	}
+	return nil
+}
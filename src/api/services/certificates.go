@@ -0,0 +1,178 @@
+package services
+
+import (
+	"access-backend/base"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CertificateService serves TLS certificate, which is reloaded from disk
+// when certificate or key file changes or on SIGHUP. Reloaded certificate
+// is used for new handshakes, established connections are kept.
+type CertificateService struct {
+	TlsConfig   *base.TlsConfig
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time
+}
+
+func NewCertificateService(config *base.TlsConfig) (*CertificateService, error) {
+	service := &CertificateService{TlsConfig: config}
+	if err := service.Reload(); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+func fileModTime(file string) (time.Time, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (service *CertificateService) readModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	var err error
+	for i, file := range []string{
+		service.TlsConfig.CertFile, service.TlsConfig.KeyFile,
+	} {
+		if modTimes[i], err = fileModTime(file); err != nil {
+			return modTimes, fmt.Errorf(
+				"certificate file '%s' open error. %s", file, err.Error(),
+			)
+		}
+	}
+	return modTimes, nil
+}
+
+// Reload loads certificate and key files. Previous certificate is kept,
+// if files are invalid, and they are not reloaded until the next change.
+func (service *CertificateService) Reload() error {
+	modTimes, err := service.readModTimes()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(
+		service.TlsConfig.CertFile, service.TlsConfig.KeyFile,
+	)
+	if err != nil {
+		service.mutex.Lock()
+		service.modTimes = modTimes
+		service.mutex.Unlock()
+		return fmt.Errorf(
+			"certificate file '%s' reading error, invalid format. %s",
+			service.TlsConfig.CertFile,
+			err.Error(),
+		)
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.certificate = &certificate
+	service.modTimes = modTimes
+	return nil
+}
+
+func (service *CertificateService) changed() bool {
+	modTimes, err := service.readModTimes()
+	if err != nil {
+		return false
+	}
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+	return modTimes != service.modTimes
+}
+
+func (service *CertificateService) GetCertificate(
+	*tls.ClientHelloInfo,
+) (*tls.Certificate, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+	return service.certificate, nil
+}
+
+func parseTlsVersion(version string) uint16 {
+	if version == "1.3" {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	available := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite '%s'", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// ServerTlsConfig returns TLS configuration of server, which takes
+// certificate from the service.
+func (service *CertificateService) ServerTlsConfig() (*tls.Config, error) {
+	suites, err := parseCipherSuites(service.TlsConfig.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     parseTlsVersion(service.TlsConfig.MinVersion),
+		CipherSuites:   suites,
+		GetCertificate: service.GetCertificate,
+	}, nil
+}
+
+func (service *CertificateService) reload(reason string) {
+	if err := service.Reload(); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"reason": reason,
+			"error":  err.Error(),
+		}).Error("Certificate reloading error")
+		return
+	}
+	base.Logger.WithFields(logrus.Fields{
+		"reason": reason,
+	}).Info("Certificate reloaded")
+}
+
+// Watch reloads certificate on SIGHUP and when files modification time
+// changes, until context is canceled.
+func (service *CertificateService) Watch(ctx context.Context) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	ticker := time.NewTicker(service.TlsConfig.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			service.reload("signal")
+		case <-ticker.C:
+			if service.changed() {
+				service.reload("file changed")
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"access-backend/base"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes self-signed certificate and its key and
+// returns DER content of certificate. Modification time of files is
+// shifted, so change is detected regardless of file system precision.
+func writeTestCertificate(
+	t *testing.T, config *base.TlsConfig, name string, shift time.Duration,
+) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyContent, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		config.CertFile: pem.EncodeToMemory(
+			&pem.Block{Type: "CERTIFICATE", Bytes: certificate},
+		),
+		config.KeyFile: pem.EncodeToMemory(
+			&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyContent},
+		),
+	}
+	modTime := time.Now().Add(shift)
+	for file, content := range files {
+		if err = os.WriteFile(file, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certificate
+}
+
+func servedCertificate(t *testing.T, service *CertificateService) []byte {
+	certificate, err := service.GetCertificate(nil)
+	if err != nil || certificate == nil {
+		t.Fatalf("expected certificate, got %v", err)
+	}
+	return certificate.Certificate[0]
+}
+
+func newTestCertificateConfig(t *testing.T) *base.TlsConfig {
+	directory := t.TempDir()
+	return &base.TlsConfig{
+		Enabled:        true,
+		CertFile:       filepath.Join(directory, "tls.crt"),
+		KeyFile:        filepath.Join(directory, "tls.key"),
+		ReloadInterval: 10 * time.Millisecond,
+	}
+}
+
+func TestCertificateReloadOnChange(t *testing.T) {
+	config := newTestCertificateConfig(t)
+	first := writeTestCertificate(t, config, "first.example.com", 0)
+	service, err := NewCertificateService(config)
+	if err != nil {
+		t.Fatalf("certificate service error: %s", err)
+	}
+	if !bytes.Equal(servedCertificate(t, service), first) {
+		t.Fatal("expected loaded certificate")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.Watch(ctx)
+
+	second := writeTestCertificate(t, config, "second.example.com", time.Second)
+	for start := time.Now(); !bytes.Equal(servedCertificate(t, service), second); {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("changed certificate is not reloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCertificateInvalidFileKeepsPrevious(t *testing.T) {
+	config := newTestCertificateConfig(t)
+	first := writeTestCertificate(t, config, "first.example.com", 0)
+	service, err := NewCertificateService(config)
+	if err != nil {
+		t.Fatalf("certificate service error: %s", err)
+	}
+
+	modTime := time.Now().Add(time.Second)
+	os.WriteFile(config.CertFile, []byte("not a certificate"), 0600)
+	os.Chtimes(config.CertFile, modTime, modTime)
+	if !service.changed() {
+		t.Fatal("expected certificate file change")
+	}
+	if err = service.Reload(); err == nil {
+		t.Fatal("expected invalid certificate error")
+	}
+	if !bytes.Equal(servedCertificate(t, service), first) {
+		t.Error("previous certificate is not kept")
+	}
+	// invalid files are not reloaded until the next change
+	if service.changed() {
+		t.Error("invalid certificate is reloaded without change")
+	}
+
+	second := writeTestCertificate(t, config, "second.example.com", 2*time.Second)
+	if !service.changed() {
+		t.Fatal("expected certificate file change")
+	}
+	if err = service.Reload(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(servedCertificate(t, service), second) {
+		t.Error("fixed certificate is not loaded")
+	}
+}
+
+func TestNewCertificateServiceInvalidFile(t *testing.T) {
+	config := newTestCertificateConfig(t)
+	os.WriteFile(config.CertFile, []byte("not a certificate"), 0600)
+	os.WriteFile(config.KeyFile, []byte("not a key"), 0600)
+	if _, err := NewCertificateService(config); err == nil {
+		t.Error("expected invalid certificate error")
+	}
+}
@@ -0,0 +1,513 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DeletionUserHeader string = "X-Deletion-User"
+const DeletionTimestampHeader string = "X-Deletion-Timestamp"
+const DeletionSignatureHeader string = "X-Deletion-Signature"
+
+type BaseDeletionService interface {
+	Start(userId string, actor string) (*api.DeletionStatusResponse, error)
+	GetStatus(userId string) (*api.DeletionStatusResponse, error)
+	Resume(userId string) (*api.DeletionStatusResponse, error)
+	Force(userId string) (*api.DeletionStatusResponse, error)
+	// WithRequestContext returns service, which traces Kratos and hook
+	// calls of started sagas as children of span in ctx and forwards
+	// request id of ctx
+	WithRequestContext(ctx context.Context) BaseDeletionService
+}
+
+// DeletionService deletes users with a saga: configured downstream hooks
+// are called in order with retries and Kratos identity is deleted only
+// after all of them succeeded. Hook request body is JSON with user_id,
+// X-Deletion-Signature header contains "sha256=" and hex HMAC-SHA256 of
+// X-Deletion-Timestamp header value, "." and body. Hooks must be
+// idempotent, 2xx and 404 responses are successful. States are saved to
+// store file, so interrupted deletions are resumed after restart. Every
+// running saga is a lifecycle worker, so shutdown waits for it. Completed deletions are kept for configured retention.
+type DeletionService struct {
+	DeletionConfig *base.DeletionConfig
+	UserService    BaseUserService
+	AuditService   BaseAuditService
+	Client         *http.Client
+	Lifecycle      *LifecycleService
+	ctx            context.Context
+	mutex          sync.Mutex
+	deletions      map[string]*api.DeletionStatusResponse
+	running        map[string]bool
+}
+
+func NewDeletionService(
+	lifecycle *LifecycleService,
+	config *base.DeletionConfig,
+	userService BaseUserService,
+) (*DeletionService, error) {
+	service := &DeletionService{
+		DeletionConfig: config,
+		UserService:    userService,
+		Client:         &http.Client{Transport: &RequestIdTransport{}},
+		Lifecycle:      lifecycle,
+		ctx:            lifecycle.Context(),
+		deletions:      map[string]*api.DeletionStatusResponse{},
+		running:        map[string]bool{},
+	}
+	if err := service.loadStore(); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+func (service *DeletionService) loadStore() error {
+	file := service.DeletionConfig.StoreFile
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("deletions file '%s' open error. %s", file, err.Error())
+	}
+	if err = json.Unmarshal(content, &service.deletions); err != nil {
+		return fmt.Errorf(
+			"deletions file '%s' reading error, invalid format. %s",
+			file,
+			err.Error(),
+		)
+	}
+	return nil
+}
+
+// saveStore must be called with locked mutex. It prunes completed
+// deletions older than retention.
+func (service *DeletionService) saveStore() {
+	expiration := time.Now().UTC().Add(-service.DeletionConfig.Retention)
+	for userId, deletion := range service.deletions {
+		if deletion.State == base.DeletionCompleted &&
+			!deletion.UpdatedAt.After(expiration) {
+			delete(service.deletions, userId)
+		}
+	}
+
+	file := service.DeletionConfig.StoreFile
+	content, err := json.Marshal(service.deletions)
+	if err == nil {
+		err = os.WriteFile(file+".tmp", content, 0600)
+	}
+	if err == nil {
+		err = os.Rename(file+".tmp", file)
+	}
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Deletions file saving error")
+	}
+}
+
+func copyDeletion(deletion *api.DeletionStatusResponse) *api.DeletionStatusResponse {
+	result := *deletion
+	result.Steps = append([]api.DeletionStep{}, deletion.Steps...)
+	return &result
+}
+
+func deletionNotFound(userId string) error {
+	return base.ServiceError{
+		Summary: "Deletion of user with id '" + userId + "' not found",
+		Status:  http.StatusNotFound,
+	}
+}
+
+// ResumeInterrupted continues deletions, which were running when service
+// stopped.
+func (service *DeletionService) ResumeInterrupted() {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	for userId, deletion := range service.deletions {
+		if deletion.State == base.DeletionRunning {
+			service.launch(service.ctx, userId)
+		}
+	}
+}
+
+func (service *DeletionService) Start(userId string, actor string) (
+	*api.DeletionStatusResponse, error,
+) {
+	return service.start(service.ctx, userId, actor)
+}
+
+func (service *DeletionService) start(
+	ctx context.Context, userId string, actor string,
+) (*api.DeletionStatusResponse, error) {
+	users := service.UserService.WithRequestContext(ctx)
+	if _, err := users.GetUser(userId); err != nil {
+		return nil, err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if deletion, ok := service.deletions[userId]; ok &&
+		deletion.State != base.DeletionCompleted {
+		return nil, base.ServiceError{
+			Summary: "Deletion of user with id '" + userId + "' already started",
+			Detail:  "Deletion state is '" + deletion.State + "'",
+			Status:  http.StatusConflict,
+		}
+	}
+
+	now := time.Now().UTC()
+	deletion := &api.DeletionStatusResponse{
+		UserId:    userId,
+		State:     base.DeletionRunning,
+		Actor:     actor,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	for _, hook := range service.DeletionConfig.Hooks {
+		deletion.Steps = append(
+			deletion.Steps,
+			api.DeletionStep{Name: hook.Name, State: base.StepPending},
+		)
+	}
+	deletion.Steps = append(
+		deletion.Steps,
+		api.DeletionStep{Name: base.KratosDeletionStep, State: base.StepPending},
+	)
+	service.deletions[userId] = deletion
+	service.saveStore()
+	service.launch(ctx, userId)
+	return copyDeletion(deletion), nil
+}
+
+func (service *DeletionService) GetStatus(userId string) (
+	*api.DeletionStatusResponse, error,
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	deletion, ok := service.deletions[userId]
+	if !ok {
+		return nil, deletionNotFound(userId)
+	}
+	return copyDeletion(deletion), nil
+}
+
+// restart must be called with locked mutex. It resets failed steps and
+// optionally skips failed downstream steps.
+func (service *DeletionService) restart(
+	ctx context.Context, userId string, force bool,
+) (*api.DeletionStatusResponse, error) {
+	deletion, ok := service.deletions[userId]
+	if !ok {
+		return nil, deletionNotFound(userId)
+	}
+	if deletion.State == base.DeletionCompleted {
+		return nil, base.ServiceError{
+			Summary: "Deletion of user with id '" + userId + "' already completed",
+			Status:  http.StatusConflict,
+		}
+	}
+	if service.running[userId] && !force {
+		return nil, base.ServiceError{
+			Summary: "Deletion of user with id '" + userId + "' is running",
+			Status:  http.StatusConflict,
+		}
+	}
+
+	for i := range deletion.Steps {
+		step := &deletion.Steps[i]
+		if step.State == base.StepDone {
+			continue
+		}
+		if force && step.Name != base.KratosDeletionStep {
+			step.State = base.StepSkipped
+		} else {
+			step.State = base.StepPending
+		}
+	}
+	deletion.Forced = deletion.Forced || force
+	deletion.State = base.DeletionRunning
+	deletion.UpdatedAt = time.Now().UTC()
+	service.saveStore()
+	service.launch(ctx, userId)
+	return copyDeletion(deletion), nil
+}
+
+func (service *DeletionService) Resume(userId string) (
+	*api.DeletionStatusResponse, error,
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	return service.restart(service.ctx, userId, false)
+}
+
+// Force skips pending and failed downstream steps and deletes Kratos
+// identity. Running downstream call is finished, but its result is ignored.
+func (service *DeletionService) Force(userId string) (
+	*api.DeletionStatusResponse, error,
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	return service.restart(service.ctx, userId, true)
+}
+
+// requestDeletionService starts sagas with request context of deletion
+// service.
+type requestDeletionService struct {
+	*DeletionService
+	ctx context.Context
+}
+
+// WithRequestContext keeps service context for sagas, so they are not
+// canceled with request, and only takes span and request id from ctx.
+func (service *DeletionService) WithRequestContext(
+	ctx context.Context,
+) BaseDeletionService {
+	traced, ok := requestContext(service.ctx, ctx)
+	if !ok {
+		return service
+	}
+	return &requestDeletionService{DeletionService: service, ctx: traced}
+}
+
+func (service *requestDeletionService) Start(userId string, actor string) (
+	*api.DeletionStatusResponse, error,
+) {
+	return service.start(service.ctx, userId, actor)
+}
+
+func (service *requestDeletionService) Resume(userId string) (
+	*api.DeletionStatusResponse, error,
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	return service.restart(service.ctx, userId, false)
+}
+
+func (service *requestDeletionService) Force(userId string) (
+	*api.DeletionStatusResponse, error,
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	return service.restart(service.ctx, userId, true)
+}
+
+// launch starts saga execution, if it is not running. It must be called
+// with locked mutex. Context must be derived from service context.
+func (service *DeletionService) launch(ctx context.Context, userId string) {
+	if service.running[userId] {
+		return
+	}
+	service.running[userId] = true
+	service.Lifecycle.Go("deletion "+userId, func(context.Context) {
+		service.execute(ctx, userId)
+	})
+}
+
+// stop marks saga not running without changing its state, so it is
+// resumed after restart.
+func (service *DeletionService) stop(userId string) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	delete(service.running, userId)
+}
+
+// nextStep returns index of the first pending step or -1. It marks
+// deletion completed or failed, if there are no pending steps, and
+// records the outcome in audit log.
+func (service *DeletionService) nextStep(userId string) (int, string) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	deletion := service.deletions[userId]
+	for i, step := range deletion.Steps {
+		if step.State == base.StepPending {
+			return i, step.Name
+		}
+		if step.State == base.StepFailed {
+			deletion.State = base.DeletionFailed
+			deletion.UpdatedAt = time.Now().UTC()
+			break
+		}
+	}
+	if deletion.State != base.DeletionFailed {
+		deletion.State = base.DeletionCompleted
+		deletion.UpdatedAt = time.Now().UTC()
+	}
+	delete(service.running, userId)
+	service.audit(copyDeletion(deletion))
+	service.saveStore()
+	return -1, ""
+}
+
+func (service *DeletionService) audit(deletion *api.DeletionStatusResponse) {
+	if service.AuditService == nil {
+		return
+	}
+	event := api.AuditEvent{
+		Actor:        deletion.Actor,
+		Action:       base.CompleteDeletionAction,
+		TargetUserId: deletion.UserId,
+		Status:       http.StatusNoContent,
+	}
+	if deletion.State == base.DeletionFailed {
+		event.Action = base.FailDeletionAction
+		event.Status = http.StatusBadGateway
+	}
+	service.AuditService.Record(&event, nil, deletion)
+}
+
+// updateStep saves result of step attempt and returns true, if step
+// should be retried.
+func (service *DeletionService) updateStep(
+	userId string, index int, attempts int, err error,
+) bool {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	deletion := service.deletions[userId]
+	step := &deletion.Steps[index]
+	// Step could be skipped by forced deletion meanwhile
+	if step.State != base.StepPending {
+		return false
+	}
+	step.Attempts = attempts
+	if err != nil {
+		step.LastError = err.Error()
+		if attempts >= service.DeletionConfig.MaxAttempts {
+			step.State = base.StepFailed
+		}
+	} else {
+		now := time.Now().UTC()
+		step.State = base.StepDone
+		step.LastError = ""
+		step.CompletedAt = &now
+	}
+	deletion.UpdatedAt = time.Now().UTC()
+	service.saveStore()
+	return step.State == base.StepPending
+}
+
+func (service *DeletionService) backoff(attempts int) time.Duration {
+	delay := service.DeletionConfig.InitialBackoff
+	for i := 1; i < attempts && delay < service.DeletionConfig.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, service.DeletionConfig.MaxBackoff)
+}
+
+func (service *DeletionService) execute(ctx context.Context, userId string) {
+	for {
+		index, name := service.nextStep(userId)
+		if index < 0 {
+			return
+		}
+
+		for attempts := 1; ; attempts++ {
+			err := service.runStep(ctx, userId, name)
+			if ctx.Err() != nil {
+				// Attempt is interrupted by shutdown and is not counted
+				service.stop(userId)
+				return
+			}
+			if !service.updateStep(userId, index, attempts, err) {
+				break
+			}
+			base.Logger.WithFields(logrus.Fields{
+				"user_id": userId,
+				"step":    name,
+				"attempt": attempts,
+				"error":   err.Error(),
+			}).Warn("User deletion step failed")
+
+			select {
+			case <-ctx.Done():
+				// Deletion stays running and is resumed after restart
+				service.stop(userId)
+				return
+			case <-time.After(service.backoff(attempts)):
+			}
+		}
+	}
+}
+
+func (service *DeletionService) runStep(
+	ctx context.Context, userId string, name string,
+) error {
+	if name == base.KratosDeletionStep {
+		users := service.UserService.WithRequestContext(ctx)
+		_, err := users.GetUser(userId)
+		if base.ErrorStatus(err) == http.StatusNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return users.DeleteUser(userId)
+	}
+
+	for _, hook := range service.DeletionConfig.Hooks {
+		if hook.Name == name {
+			return service.callHook(ctx, &hook, userId)
+		}
+	}
+	return fmt.Errorf("deletion hook '%s' is not configured", name)
+}
+
+func (service *DeletionService) callHook(
+	ctx context.Context, hook *base.DeletionHookConfig, userId string,
+) error {
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = service.DeletionConfig.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{"user_id": userId})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, hook.Url, bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(DeletionUserHeader, userId)
+	request.Header.Set(DeletionTimestampHeader, timestamp)
+	request.Header.Set(
+		DeletionSignatureHeader, signWebhookBody(hook.Secret, timestamp, body),
+	)
+
+	response, err := service.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+	return nil
+}
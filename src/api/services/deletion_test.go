@@ -0,0 +1,256 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUserService keeps users, which are not deleted yet, and request ids
+// of contexts it was called with.
+type fakeUserService struct {
+	BaseUserService
+	mutex      sync.Mutex
+	users      map[string]bool
+	requestIds []string
+}
+
+func (service *fakeUserService) WithRequestContext(
+	ctx context.Context,
+) BaseUserService {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.requestIds = append(service.requestIds, api.RequestIdFromContext(ctx))
+	return service
+}
+
+func (service *fakeUserService) GetUser(userId string) (*api.UserResponse, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if !service.users[userId] {
+		return nil, base.ServiceError{Status: http.StatusNotFound}
+	}
+	return &api.UserResponse{Id: userId}, nil
+}
+
+func (service *fakeUserService) DeleteUser(userId string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	delete(service.users, userId)
+	return nil
+}
+
+type recordingAuditService struct {
+	BaseAuditService
+	mutex  sync.Mutex
+	events []api.AuditEvent
+}
+
+func (service *recordingAuditService) Record(
+	event *api.AuditEvent, _ any, _ any,
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.events = append(service.events, *event)
+}
+
+func (service *recordingAuditService) actions() []string {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	var actions []string
+	for _, event := range service.events {
+		actions = append(actions, event.Action)
+	}
+	return actions
+}
+
+func newTestDeletionService(
+	t *testing.T, lifecycle *LifecycleService, config *base.DeletionConfig,
+) (*DeletionService, *recordingAuditService) {
+	config.StoreFile = filepath.Join(t.TempDir(), "deletions.json")
+	config.Timeout = time.Second
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = time.Millisecond
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 2
+	}
+	service, err := NewDeletionService(
+		lifecycle, config, &fakeUserService{users: map[string]bool{"42": true}},
+	)
+	if err != nil {
+		t.Fatalf("deletion service error: %s", err)
+	}
+	audit := &recordingAuditService{}
+	service.AuditService = audit
+	return service, audit
+}
+
+// waitStopped waits until saga of user is not running.
+func waitStopped(t *testing.T, service *DeletionService, userId string) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		service.mutex.Lock()
+		running := service.running[userId]
+		service.mutex.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("deletion is still running")
+}
+
+func TestDeletionAuditsOutcome(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		},
+	))
+	defer downstream.Close()
+
+	service, audit := newTestDeletionService(
+		t,
+		NewLifecycleService(),
+		&base.DeletionConfig{
+			Hooks:     []base.DeletionHookConfig{{Name: "files", Url: downstream.URL}},
+			Retention: time.Hour,
+		},
+	)
+	if _, err := service.Start("42", "admin"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	waitStopped(t, service, "42")
+	status, _ := service.GetStatus("42")
+	if status.State != base.DeletionFailed || status.Steps[0].Attempts != 2 {
+		t.Fatalf("expected failed deletion after 2 attempts, got %+v", status)
+	}
+
+	if _, err := service.Force("42"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	waitStopped(t, service, "42")
+	if status, _ = service.GetStatus("42"); status.State != base.DeletionCompleted {
+		t.Fatalf("expected completed deletion, got %+v", status)
+	}
+
+	expected := []string{base.FailDeletionAction, base.CompleteDeletionAction}
+	actions := audit.actions()
+	if strings.Join(actions, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected audit actions %v, got %v", expected, actions)
+	}
+	if audit.events[0].Actor != "admin" || audit.events[0].TargetUserId != "42" {
+		t.Errorf("unexpected audit event %+v", audit.events[0])
+	}
+}
+
+func TestDeletionPrunesCompleted(t *testing.T) {
+	service, _ := newTestDeletionService(
+		t, NewLifecycleService(), &base.DeletionConfig{},
+	)
+	if _, err := service.Start("42", "admin"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	waitStopped(t, service, "42")
+
+	if _, err := service.GetStatus("42"); base.ErrorStatus(err) != http.StatusNotFound {
+		t.Errorf("completed deletion is not pruned, got %v", err)
+	}
+	content, err := os.ReadFile(service.DeletionConfig.StoreFile)
+	if err != nil {
+		t.Fatalf("store file error: %s", err)
+	}
+	if string(content) != "{}" {
+		t.Errorf("expected empty store, got %s", content)
+	}
+	if _, err = os.Stat(service.DeletionConfig.StoreFile + ".tmp"); err == nil {
+		t.Error("temporary store file is left")
+	}
+}
+
+func TestDeletionShutdownDoesNotCountAttempt(t *testing.T) {
+	called := make(chan struct{}, 1)
+	downstream := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			// request context is canceled on disconnect after body is read
+			io.ReadAll(request.Body)
+			called <- struct{}{}
+			<-request.Context().Done()
+		},
+	))
+	defer downstream.Close()
+
+	lifecycle := NewLifecycleService()
+	service, audit := newTestDeletionService(
+		t,
+		lifecycle,
+		&base.DeletionConfig{
+			Hooks:       []base.DeletionHookConfig{{Name: "files", Url: downstream.URL}},
+			MaxAttempts: 1,
+		},
+	)
+	if _, err := service.Start("42", "admin"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	<-called
+	if running := lifecycle.Stop(5 * time.Second); len(running) != 0 {
+		t.Fatalf("workers are not stopped: %v", running)
+	}
+
+	status, _ := service.GetStatus("42")
+	if status.State != base.DeletionRunning ||
+		status.Steps[0].State != base.StepPending ||
+		status.Steps[0].Attempts != 0 {
+		t.Errorf("expected interrupted step to stay pending, got %+v", status)
+	}
+	if actions := audit.actions(); len(actions) != 0 {
+		t.Errorf("unexpected audit actions %v", actions)
+	}
+}
+
+func TestDeletionForwardsRequestContext(t *testing.T) {
+	forwarded := make(chan string, 1)
+	downstream := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			forwarded <- request.Header.Get(base.RequestIdHeader)
+		},
+	))
+	defer downstream.Close()
+
+	service, _ := newTestDeletionService(
+		t,
+		NewLifecycleService(),
+		&base.DeletionConfig{
+			Hooks:     []base.DeletionHookConfig{{Name: "files", Url: downstream.URL}},
+			Retention: time.Hour,
+		},
+	)
+	ctx := api.ContextWithRequestId(context.Background(), "9f2c51e0a4b8d3c7")
+	if _, err := service.WithRequestContext(ctx).Start("42", "admin"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	waitStopped(t, service, "42")
+
+	if requestId := <-forwarded; requestId != "9f2c51e0a4b8d3c7" {
+		t.Errorf("expected request id forwarded to hook, got %q", requestId)
+	}
+	users := service.UserService.(*fakeUserService)
+	users.mutex.Lock()
+	defer users.mutex.Unlock()
+	// user is checked on start and before deletion by Kratos step
+	if len(users.requestIds) != 2 {
+		t.Fatalf("expected 2 Kratos calls with context, got %v", users.requestIds)
+	}
+	for _, requestId := range users.requestIds {
+		if requestId != "9f2c51e0a4b8d3c7" {
+			t.Errorf("expected request id of Kratos calls, got %v", users.requestIds)
+		}
+	}
+}
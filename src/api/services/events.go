@@ -0,0 +1,59 @@
+package services
+
+import (
+	"access-backend/api"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// EventSubscriber handles published user events. HandleEvent is called
+// synchronously by publisher, so it must not block.
+type EventSubscriber interface {
+	HandleEvent(event *api.UserEvent)
+}
+
+// EventDispatcher fans out user events to all subscribers. Nil dispatcher
+// silently drops events.
+type EventDispatcher struct {
+	mutex       sync.RWMutex
+	subscribers []EventSubscriber
+}
+
+func newEventId() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+func (dispatcher *EventDispatcher) Subscribe(subscriber EventSubscriber) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	dispatcher.subscribers = append(dispatcher.subscribers, subscriber)
+}
+
+func (dispatcher *EventDispatcher) Publish(
+	eventType string, userId string, user *api.UserResponse,
+) {
+	if dispatcher == nil {
+		return
+	}
+
+	event := api.UserEvent{
+		Id:     newEventId(),
+		Type:   eventType,
+		Time:   time.Now().UTC(),
+		UserId: userId,
+		User:   user,
+	}
+
+	dispatcher.mutex.RLock()
+	defer dispatcher.mutex.RUnlock()
+	for _, subscriber := range dispatcher.subscribers {
+		subscriber.HandleEvent(&event)
+	}
+}
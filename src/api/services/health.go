@@ -0,0 +1,202 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"fmt"
+	ory "github.com/ory/kratos-client-go"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthCheckFunc returns error, if dependency is not usable.
+type HealthCheckFunc func(ctx context.Context) error
+
+type BaseHealthService interface {
+	Readiness() *api.ReadinessResponse
+}
+
+// HealthService checks dependencies of the service concurrently. Results
+// are cached for CacheTtl, so frequent probes do not load dependencies.
+// Only one check runs at a time, expired result is served while it runs.
+type HealthService struct {
+	HealthConfig *base.HealthConfig
+	Lifecycle    *LifecycleService
+	checks       map[string]HealthCheckFunc
+	mutex        sync.Mutex
+	cached       *api.ReadinessResponse
+	expiresAt    time.Time
+	// Closed when running check is finished, nil if no check runs
+	checking chan struct{}
+}
+
+func NewHealthService(
+	config *base.HealthConfig, lifecycle *LifecycleService,
+) *HealthService {
+	return &HealthService{
+		HealthConfig: config,
+		Lifecycle:    lifecycle,
+		checks:       map[string]HealthCheckFunc{},
+	}
+}
+
+// AddCheck registers dependency check, it must be called before serving.
+func (service *HealthService) AddCheck(name string, check HealthCheckFunc) {
+	service.checks[name] = check
+}
+
+// runCheck returns after timeout, even if check ignores context.
+func (service *HealthService) runCheck(check HealthCheckFunc) api.DependencyStatus {
+	ctx, cancel := context.WithTimeout(
+		context.Background(), service.HealthConfig.Timeout,
+	)
+	defer cancel()
+
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() {
+		result <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = fmt.Errorf(
+			"check timed out after %s", service.HealthConfig.Timeout,
+		)
+	}
+	status := api.DependencyStatus{
+		Status:    base.HealthStatusOk,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = base.HealthStatusUnavailable
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func (service *HealthService) check() *api.ReadinessResponse {
+	names := make([]string, 0, len(service.checks))
+	for name := range service.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := make([]api.DependencyStatus, len(names))
+	var wait sync.WaitGroup
+	for i, name := range names {
+		wait.Add(1)
+		go func(i int, check HealthCheckFunc) {
+			defer wait.Done()
+			statuses[i] = service.runCheck(check)
+		}(i, service.checks[name])
+	}
+	wait.Wait()
+
+	response := &api.ReadinessResponse{
+		Status:       base.HealthStatusOk,
+		CheckedAt:    time.Now().UTC(),
+		Dependencies: make(map[string]api.DependencyStatus, len(names)),
+	}
+	for i, name := range names {
+		response.Dependencies[name] = statuses[i]
+		if statuses[i].Status != base.HealthStatusOk {
+			response.Status = base.HealthStatusUnavailable
+		}
+	}
+	return response
+}
+
+// Readiness returns status of all dependencies. Service is not ready, if
+// any dependency is unavailable or service is shutting down.
+func (service *HealthService) Readiness() *api.ReadinessResponse {
+	service.mutex.Lock()
+	if service.cached == nil || time.Now().After(service.expiresAt) {
+		service.refresh()
+	}
+	cached, checking := service.cached, service.checking
+	service.mutex.Unlock()
+
+	// The first check is awaited, later ones are not
+	if cached == nil {
+		<-checking
+		service.mutex.Lock()
+		cached = service.cached
+		service.mutex.Unlock()
+	}
+
+	response := *cached
+	if service.Lifecycle != nil && service.Lifecycle.ShuttingDown() {
+		response.Status = base.HealthStatusShuttingDown
+	}
+	return &response
+}
+
+// refresh starts check, if it is not running. It must be called with
+// locked mutex.
+func (service *HealthService) refresh() {
+	if service.checking != nil {
+		return
+	}
+	checking := make(chan struct{})
+	service.checking = checking
+	go func() {
+		response := service.check()
+		service.mutex.Lock()
+		service.cached = response
+		service.expiresAt = time.Now().Add(service.HealthConfig.CacheTtl)
+		service.checking = nil
+		service.mutex.Unlock()
+		close(checking)
+	}()
+}
+
+// KratosReadyCheck calls Kratos admin /health/ready endpoint, which checks
+// Kratos database too.
+func KratosReadyCheck(client *ory.APIClient) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		_, _, err := client.MetadataAPI.IsReady(ctx).Execute()
+		return err
+	}
+}
+
+// KratosSchemaCheck checks that user identity schema exists and has all
+// traits mapped by the service.
+func KratosSchemaCheck(client *ory.APIClient) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		schema, response, err := client.IdentityAPI.GetIdentitySchema(
+			ctx, base.UserSchemaId,
+		).Execute()
+		if err != nil {
+			if response != nil && response.StatusCode == http.StatusNotFound {
+				return fmt.Errorf(
+					"identity schema '%s' not found", base.UserSchemaId,
+				)
+			}
+			return err
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		traits, _ := properties["traits"].(map[string]any)
+		traitProperties, _ := traits["properties"].(map[string]any)
+		var missing []string
+		for _, trait := range base.UserSchemaTraits {
+			if _, ok := traitProperties[string(trait)]; !ok {
+				missing = append(missing, string(trait))
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf(
+				"identity schema '%s' has no traits: %s",
+				base.UserSchemaId,
+				strings.Join(missing, ", "),
+			)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"access-backend/base"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	service := NewHealthService(
+		&base.HealthConfig{Timeout: 20 * time.Millisecond}, nil,
+	)
+	// check ignores context like file stores waiting for their mutex
+	service.AddCheck("stuck", func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	start := time.Now()
+	response := service.Readiness()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("readiness took %s", elapsed)
+	}
+	status := response.Dependencies["stuck"]
+	if response.Status != base.HealthStatusUnavailable ||
+		!strings.Contains(status.Error, "timed out") {
+		t.Errorf("expected timed out check, got %+v", response)
+	}
+}
+
+func TestHealthSingleFlight(t *testing.T) {
+	var calls atomic.Int64
+	var blocking atomic.Bool
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	service := NewHealthService(&base.HealthConfig{Timeout: time.Second}, nil)
+	service.AddCheck("kratos", func(context.Context) error {
+		calls.Add(1)
+		if blocking.Load() {
+			started <- struct{}{}
+			<-release
+			return errors.New("kratos is unavailable")
+		}
+		return nil
+	})
+
+	if response := service.Readiness(); response.Status != base.HealthStatusOk {
+		t.Fatalf("expected ready service, got %+v", response)
+	}
+	// result expires immediately with zero cacheTtl
+	blocking.Store(true)
+	for i := 0; i < 3; i++ {
+		if response := service.Readiness(); response.Status != base.HealthStatusOk {
+			t.Fatalf("expected previous result, got %+v", response)
+		}
+	}
+	<-started
+	if count := calls.Load(); count != 2 {
+		t.Errorf("expected 2 checks, got %d", count)
+	}
+
+	service.mutex.Lock()
+	checking := service.checking
+	service.mutex.Unlock()
+	close(release)
+	<-checking
+	blocking.Store(false)
+	if response := service.Readiness(); response.Status != base.HealthStatusUnavailable {
+		t.Errorf("expected result of finished check, got %+v", response)
+	}
+}
@@ -0,0 +1,493 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	ory "github.com/ory/kratos-client-go"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BaseHistoryService interface {
+	Baseline(userId string) error
+	Record(userId string, actor string, source string) error
+	GetHistory(userId string) (*api.GetUserHistoryResponse, error)
+	Restore(userId string, version int64, actor string) (
+		*api.UserResponse, error,
+	)
+	// WithRequestContext returns service, which traces Kratos calls as
+	// children of span in ctx and forwards request id of ctx
+	WithRequestContext(ctx context.Context) BaseHistoryService
+}
+
+// HistoryService keeps versions of identity traits and metadata. Version
+// is recorded from identity fetched from Kratos after every change, only
+// if something changed. Baseline version of user without history is
+// recorded before change, so the first change has its previous state.
+// Versions are appended to file as JSON lines and the latest MaxVersions
+// versions of every user are kept in memory. File is compacted to kept
+// versions, when it contains twice more of them.
+type HistoryService struct {
+	HistoryConfig *base.HistoryConfig
+	Context       *context.Context
+	KratosClient  *ory.APIClient
+	Events        *EventDispatcher
+	mutex         sync.Mutex
+	file          *os.File
+	versions      map[string][]api.UserVersion
+	// userLocks serialize fetching identity and appending its version
+	userLocks map[string]*userLock
+	// written is number of versions in file, kept is number of them in
+	// memory
+	written int
+	kept    int
+}
+
+type userLock struct {
+	mutex sync.Mutex
+	users int
+}
+
+func NewHistoryService(
+	config *base.HistoryConfig,
+	ctx *context.Context,
+	client *ory.APIClient,
+	events *EventDispatcher,
+) (*HistoryService, error) {
+	file, err := os.OpenFile(
+		config.File, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600,
+	)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"history file '%s' open error. %s", config.File, err.Error(),
+		)
+	}
+
+	service := &HistoryService{
+		HistoryConfig: config,
+		Context:       ctx,
+		KratosClient:  client,
+		Events:        events,
+		file:          file,
+		versions:      map[string][]api.UserVersion{},
+		userLocks:     map[string]*userLock{},
+	}
+	if err = service.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf(
+			"history file '%s' reading error, invalid format. %s",
+			config.File,
+			err.Error(),
+		)
+	}
+	if err = service.compact(); err != nil {
+		service.file.Close()
+		return nil, err
+	}
+	return service, nil
+}
+
+func (service *HistoryService) load() error {
+	scanner := bufio.NewScanner(service.file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var version api.UserVersion
+		if err := json.Unmarshal([]byte(line), &version); err != nil {
+			return err
+		}
+		service.keep(&version)
+		service.written++
+	}
+	return scanner.Err()
+}
+
+func (service *HistoryService) keep(version *api.UserVersion) {
+	versions := append(service.versions[version.UserId], *version)
+	service.kept++
+	if overflow := len(versions) - service.HistoryConfig.MaxVersions; overflow > 0 {
+		versions = versions[overflow:]
+		service.kept -= overflow
+	}
+	service.versions[version.UserId] = versions
+}
+
+// compact rewrites file with kept versions only, if file contains twice
+// more versions. Mutex must be locked.
+func (service *HistoryService) compact() error {
+	if service.written <= 2*service.kept {
+		return nil
+	}
+	path := service.HistoryConfig.File
+	file, err := os.OpenFile(
+		path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600,
+	)
+	if err != nil {
+		return fmt.Errorf(
+			"history file '%s' compaction error. %s", path, err.Error(),
+		)
+	}
+	writer := bufio.NewWriter(file)
+	for _, versions := range service.versions {
+		for i := range versions {
+			content, err := json.Marshal(&versions[i])
+			if err != nil {
+				file.Close()
+				return err
+			}
+			writer.Write(append(content, '\n'))
+		}
+	}
+	if err = writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf(
+			"history file '%s' compaction error. %s", path, err.Error(),
+		)
+	}
+
+	compacted, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("history file '%s' open error. %s", path, err.Error())
+	}
+	service.file.Close()
+	service.file = compacted
+	base.Logger.WithFields(logrus.Fields{
+		"versions": service.kept,
+		"removed":  service.written - service.kept,
+	}).Info("History file compacted")
+	service.written = service.kept
+	return nil
+}
+
+// lockUser locks user, so only one version of user is recorded at a time,
+// and returns unlocking function.
+func (service *HistoryService) lockUser(userId string) func() {
+	service.mutex.Lock()
+	lock, ok := service.userLocks[userId]
+	if !ok {
+		lock = &userLock{}
+		service.userLocks[userId] = lock
+	}
+	lock.users++
+	service.mutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+		service.mutex.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(service.userLocks, userId)
+		}
+		service.mutex.Unlock()
+	}
+}
+
+func (service *HistoryService) Close() error {
+	return service.file.Close()
+}
+
+// versionFields flattens version to comparable fields by path.
+func versionFields(version *api.UserVersion) map[string]any {
+	fields := map[string]any{
+		"state":           version.State,
+		"metadata_public": version.MetadataPublic,
+		"metadata_admin":  version.MetadataAdmin,
+	}
+	for name, value := range version.Traits {
+		fields["traits."+name] = value
+	}
+	return fields
+}
+
+func versionChanges(
+	previous *api.UserVersion, current *api.UserVersion,
+) map[string]api.AuditChange {
+	before := map[string]any{}
+	if previous != nil {
+		before = versionFields(previous)
+	}
+	after := versionFields(current)
+
+	changes := map[string]api.AuditChange{}
+	for name, value := range after {
+		if !reflect.DeepEqual(before[name], value) {
+			changes[name] = api.AuditChange{Before: before[name], After: value}
+		}
+	}
+	for name, value := range before {
+		if _, ok := after[name]; !ok && value != nil {
+			changes[name] = api.AuditChange{Before: value}
+		}
+	}
+	return changes
+}
+
+// normalizeJson converts value to its JSON representation, so values
+// loaded from file and fetched from Kratos are compared equally.
+func normalizeJson(value any) any {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized any
+	if err = json.Unmarshal(content, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func (service *HistoryService) getIdentity(
+	ctx context.Context, userId string,
+) (*ory.Identity, error) {
+	identity, response, err := service.KratosClient.IdentityAPI.GetIdentity(
+		ctx, userId,
+	).Execute()
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil, base.ServiceError{
+				Summary: "User with id '" + userId + "' not found",
+				Status:  http.StatusNotFound,
+			}
+		}
+		return nil, base.NewKratosError("Error retrieving user", err)
+	}
+	return identity, nil
+}
+
+func identityToVersion(
+	identity *ory.Identity, actor string, source string,
+) *api.UserVersion {
+	traits, _ := normalizeJson(identity.Traits).(map[string]any)
+	return &api.UserVersion{
+		UserId:         identity.Id,
+		Time:           time.Now().UTC(),
+		Actor:          actor,
+		Source:         source,
+		State:          identity.GetState(),
+		Traits:         traits,
+		MetadataPublic: normalizeJson(identity.MetadataPublic),
+		MetadataAdmin:  normalizeJson(identity.MetadataAdmin),
+	}
+}
+
+// requestHistoryService calls Kratos with request context of history
+// service.
+type requestHistoryService struct {
+	*HistoryService
+	ctx context.Context
+}
+
+// WithRequestContext keeps service context for Kratos calls, so they are
+// not canceled with request, and only takes span and request id from ctx.
+func (service *HistoryService) WithRequestContext(
+	ctx context.Context,
+) BaseHistoryService {
+	traced, ok := requestContext(*service.Context, ctx)
+	if !ok {
+		return service
+	}
+	return &requestHistoryService{HistoryService: service, ctx: traced}
+}
+
+func (service *requestHistoryService) Baseline(userId string) error {
+	return service.baseline(service.ctx, userId)
+}
+
+func (service *requestHistoryService) Record(
+	userId string, actor string, source string,
+) error {
+	return service.record(service.ctx, userId, actor, source)
+}
+
+func (service *requestHistoryService) Restore(
+	userId string, version int64, actor string,
+) (*api.UserResponse, error) {
+	return service.restore(service.ctx, userId, version, actor)
+}
+
+// Baseline records current identity as the first version of user, if
+// user has no history. It is called before change, so the first change
+// has previous state.
+func (service *HistoryService) Baseline(userId string) error {
+	return service.baseline(*service.Context, userId)
+}
+
+func (service *HistoryService) baseline(ctx context.Context, userId string) error {
+	unlock := service.lockUser(userId)
+	defer unlock()
+
+	service.mutex.Lock()
+	known := len(service.versions[userId]) > 0
+	service.mutex.Unlock()
+	if known {
+		return nil
+	}
+	identity, err := service.getIdentity(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return service.append(
+		identityToVersion(identity, "", base.BaselineHistorySource),
+	)
+}
+
+// Record fetches identity from Kratos and appends new version, if traits,
+// state or metadata differ from the latest version.
+func (service *HistoryService) Record(
+	userId string, actor string, source string,
+) error {
+	return service.record(*service.Context, userId, actor, source)
+}
+
+func (service *HistoryService) record(
+	ctx context.Context, userId string, actor string, source string,
+) error {
+	unlock := service.lockUser(userId)
+	defer unlock()
+
+	identity, err := service.getIdentity(ctx, userId)
+	if err != nil {
+		return err
+	}
+	return service.append(identityToVersion(identity, actor, source))
+}
+
+// append numbers version after the latest one and writes it, if
+// something changed.
+func (service *HistoryService) append(version *api.UserVersion) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	var previous *api.UserVersion
+	if versions := service.versions[version.UserId]; len(versions) > 0 {
+		previous = &versions[len(versions)-1]
+		version.Version = previous.Version
+	}
+	version.Version++
+	version.Changes = versionChanges(previous, version)
+	if len(version.Changes) == 0 {
+		return nil
+	}
+
+	content, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	if _, err = service.file.Write(append(content, '\n')); err != nil {
+		return err
+	}
+	service.keep(version)
+	service.written++
+	if err = service.compact(); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("History file compaction error")
+	}
+	return nil
+}
+
+func (service *HistoryService) GetHistory(userId string) (
+	*api.GetUserHistoryResponse, error,
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	versions := service.versions[userId]
+	if len(versions) == 0 {
+		return nil, base.ServiceError{
+			Summary: "History of user with id '" + userId + "' not found",
+			Status:  http.StatusNotFound,
+		}
+	}
+	return &api.GetUserHistoryResponse{
+		List: append([]api.UserVersion{}, versions...),
+	}, nil
+}
+
+func (service *HistoryService) findVersion(userId string, version int64) (
+	*api.UserVersion, error,
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	for _, stored := range service.versions[userId] {
+		if stored.Version == version {
+			return &stored, nil
+		}
+	}
+	return nil, base.ServiceError{
+		Summary: "Version " + strconv.FormatInt(version, 10) +
+			" of user with id '" + userId + "' not found",
+		Status: http.StatusNotFound,
+	}
+}
+
+// Restore applies traits and metadata of version to identity with Kratos
+// UpdateIdentity, state of identity is not changed. Restoring is recorded
+// as a new version.
+func (service *HistoryService) Restore(
+	userId string, version int64, actor string,
+) (*api.UserResponse, error) {
+	return service.restore(*service.Context, userId, version, actor)
+}
+
+func (service *HistoryService) restore(
+	ctx context.Context, userId string, version int64, actor string,
+) (*api.UserResponse, error) {
+	stored, err := service.findVersion(userId, version)
+	if err != nil {
+		return nil, err
+	}
+	current, err := service.getIdentity(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, _, err := service.KratosClient.IdentityAPI.UpdateIdentity(
+		ctx, userId,
+	).UpdateIdentityBody(ory.UpdateIdentityBody{
+		SchemaId:       current.SchemaId,
+		State:          current.GetState(),
+		Traits:         stored.Traits,
+		MetadataPublic: stored.MetadataPublic,
+		MetadataAdmin:  stored.MetadataAdmin,
+	}).Execute()
+	if err != nil {
+		return nil, base.NewKratosError("Error restoring user version", err)
+	}
+
+	result := kratosIdentityToUser(identity)
+	if result == nil {
+		return nil, base.ServiceError{Summary: "User data not parsed"}
+	}
+	err = service.record(ctx, userId, actor, base.RestoreHistorySource)
+	if err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"user_id": userId,
+			"error":   err.Error(),
+		}).Error("User history recording error")
+	}
+	service.Events.Publish(base.UserUpdatedEvent, userId, result)
+	return result, nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"encoding/json"
+	ory "github.com/ory/kratos-client-go"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeIdentityServer serves identity of user "42" with username, which
+// can be changed by test, and keeps the last forwarded request id.
+type fakeIdentityServer struct {
+	mutex     sync.Mutex
+	username  string
+	requestId string
+}
+
+func (server *fakeIdentityServer) setUsername(username string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.username = username
+}
+
+func (server *fakeIdentityServer) ServeHTTP(
+	writer http.ResponseWriter, request *http.Request,
+) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.requestId = request.Header.Get(base.RequestIdHeader)
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(
+		testIdentity("42", testTraits(server.username)),
+	)
+}
+
+func newTestHistoryService(
+	t *testing.T, path string, maxVersions int,
+) (*HistoryService, *fakeIdentityServer) {
+	identities := &fakeIdentityServer{username: "john"}
+	kratos := httptest.NewServer(identities)
+	t.Cleanup(kratos.Close)
+
+	configuration := ory.NewConfiguration()
+	configuration.Servers = ory.ServerConfigurations{{URL: kratos.URL}}
+	configuration.HTTPClient = &http.Client{Transport: &RequestIdTransport{}}
+	ctx := context.Background()
+	service, err := NewHistoryService(
+		&base.HistoryConfig{File: path, MaxVersions: maxVersions},
+		&ctx,
+		ory.NewAPIClient(configuration),
+		&EventDispatcher{},
+	)
+	if err != nil {
+		t.Fatalf("history service error: %s", err)
+	}
+	t.Cleanup(func() { service.Close() })
+	return service, identities
+}
+
+func TestHistoryBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.log")
+	service, identities := newTestHistoryService(t, path, 10)
+
+	if err := service.Baseline("42"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	identities.setUsername("jim")
+	if err := service.Record("42", "admin", base.ApiHistorySource); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// baseline is recorded only for user without history
+	if err := service.Baseline("42"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	history, err := service.GetHistory("42")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(history.List) != 2 {
+		t.Fatalf("expected 2 versions, got %+v", history.List)
+	}
+	if history.List[0].Source != base.BaselineHistorySource {
+		t.Errorf("expected baseline version, got %+v", history.List[0])
+	}
+	change := history.List[1].Changes["traits."+string(base.Username)]
+	if change.Before != "john" || change.After != "jim" {
+		t.Errorf("expected change from john to jim, got %+v", change)
+	}
+}
+
+func TestHistoryForwardsRequestContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.log")
+	service, identities := newTestHistoryService(t, path, 10)
+
+	ctx := api.ContextWithRequestId(context.Background(), "9f2c51e0a4b8d3c7")
+	err := service.WithRequestContext(ctx).Record(
+		"42", "admin", base.ApiHistorySource,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	identities.mutex.Lock()
+	defer identities.mutex.Unlock()
+	if identities.requestId != "9f2c51e0a4b8d3c7" {
+		t.Errorf("expected forwarded request id, got %q", identities.requestId)
+	}
+}
+
+func TestHistoryConcurrentRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.log")
+	service, _ := newTestHistoryService(t, path, 10)
+
+	var records sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		records.Add(1)
+		go func() {
+			defer records.Done()
+			service.Record("42", "admin", base.ApiHistorySource)
+		}()
+	}
+	records.Wait()
+
+	history, err := service.GetHistory("42")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(history.List) != 1 {
+		t.Errorf(
+			"expected single version of unchanged user, got %d",
+			len(history.List),
+		)
+	}
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.log")
+	service, identities := newTestHistoryService(t, path, 2)
+
+	for _, username := range []string{"a", "b", "c", "d", "e"} {
+		identities.setUsername(username)
+		if err := service.Record("42", "admin", base.ApiHistorySource); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines > 4 {
+		t.Errorf("expected compacted file, got %d versions", lines)
+	}
+
+	service.Close()
+	reloaded, _ := newTestHistoryService(t, path, 2)
+	history, err := reloaded.GetHistory("42")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(history.List) != 2 || history.List[1].Version != 5 {
+		t.Errorf("expected versions 4 and 5, got %+v", history.List)
+	}
+}
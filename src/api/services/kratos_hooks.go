@@ -0,0 +1,45 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	ory "github.com/ory/kratos-client-go"
+	"net/http"
+)
+
+type BaseKratosHookService interface {
+	HandleHook(flow string, payload *api.KratosHookPayload) (
+		*api.UserResponse, error,
+	)
+}
+
+// KratosHookService handles Kratos web hooks called after self-service
+// flows and publishes events for changed users.
+type KratosHookService struct {
+	BaseKratosHookService
+	Events *EventDispatcher
+}
+
+func (service *KratosHookService) HandleHook(
+	flow string, payload *api.KratosHookPayload,
+) (*api.UserResponse, error) {
+	user := kratosIdentityToUser(&ory.Identity{
+		Id:     payload.Identity.Id,
+		State:  &payload.Identity.State,
+		Traits: payload.Identity.Traits,
+	})
+	if user == nil {
+		return nil, base.ServiceError{
+			Summary: "Identity '" + payload.Identity.Id + "' has invalid traits",
+			Status:  http.StatusUnprocessableEntity,
+		}
+	}
+
+	switch flow {
+	case base.RegistrationFlow:
+		service.Events.Publish(base.UserCreatedEvent, user.Id, user)
+	case base.SettingsFlow:
+		service.Events.Publish(base.UserUpdatedEvent, user.Id, user)
+	}
+	return user, nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"access-backend/base"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	KratosCallOk          string = "ok"
+	KratosCallNotFound    string = "not_found"
+	KratosCallClientError string = "client_error"
+	KratosCallServerError string = "server_error"
+	KratosCallTimeout     string = "timeout"
+	KratosCallNetwork     string = "network"
+)
+
+// KratosMetricsTransport records Kratos admin API calls metrics by
+// operation, which is derived from request method and path.
+type KratosMetricsTransport struct {
+	Next http.RoundTripper
+}
+
+// kratosOperation returns name of Kratos client method for request.
+func kratosOperation(request *http.Request) string {
+	path := strings.Trim(request.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	method := request.Method
+
+	switch {
+	case path == "admin/identities":
+		if method == http.MethodPost {
+			return "CreateIdentity"
+		}
+		if method == http.MethodGet {
+			return "ListIdentities"
+		}
+	case len(parts) == 3 && parts[0] == "admin" && parts[1] == "identities":
+		switch method {
+		case http.MethodGet:
+			return "GetIdentity"
+		case http.MethodPut:
+			return "UpdateIdentity"
+		case http.MethodPatch:
+			return "PatchIdentity"
+		case http.MethodDelete:
+			return "DeleteIdentity"
+		}
+	case len(parts) == 4 && parts[1] == "identities" && parts[3] == "sessions":
+		if method == http.MethodDelete {
+			return "DeleteIdentitySessions"
+		}
+		return "ListIdentitySessions"
+	case path == "health/ready":
+		return "IsReady"
+	case len(parts) == 2 && parts[0] == "schemas":
+		return "GetIdentitySchema"
+	}
+	return "Other"
+}
+
+func kratosCallClass(response *http.Response, err error) string {
+	if err != nil {
+		var netError net.Error
+		if errors.Is(err, context.DeadlineExceeded) ||
+			(errors.As(err, &netError) && netError.Timeout()) {
+			return KratosCallTimeout
+		}
+		return KratosCallNetwork
+	}
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return KratosCallNotFound
+	case response.StatusCode >= 500:
+		return KratosCallServerError
+	case response.StatusCode >= 400:
+		return KratosCallClientError
+	}
+	return KratosCallOk
+}
+
+func (transport *KratosMetricsTransport) RoundTrip(
+	request *http.Request,
+) (*http.Response, error) {
+	next := transport.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	operation := kratosOperation(request)
+	start := time.Now()
+	response, err := next.RoundTrip(request)
+	base.KratosRequestDuration.WithLabelValues(operation).Observe(
+		time.Since(start).Seconds(),
+	)
+	base.KratosRequestsTotal.WithLabelValues(
+		operation, kratosCallClass(response, err),
+	).Inc()
+	return response, err
+}
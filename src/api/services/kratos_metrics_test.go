@@ -0,0 +1,106 @@
+package services
+
+import (
+	"access-backend/base"
+	"context"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKratosOperation(t *testing.T) {
+	tests := []struct {
+		method    string
+		path      string
+		operation string
+	}{
+		{http.MethodPost, "/admin/identities", "CreateIdentity"},
+		{http.MethodGet, "/admin/identities", "ListIdentities"},
+		{http.MethodGet, "/admin/identities/6e98ca78", "GetIdentity"},
+		{http.MethodPut, "/admin/identities/6e98ca78", "UpdateIdentity"},
+		{http.MethodPatch, "/admin/identities/6e98ca78", "PatchIdentity"},
+		{http.MethodDelete, "/admin/identities/6e98ca78", "DeleteIdentity"},
+		{http.MethodDelete, "/admin/identities/6e98ca78/sessions", "DeleteIdentitySessions"},
+		{http.MethodGet, "/admin/identities/6e98ca78/sessions", "ListIdentitySessions"},
+		{http.MethodGet, "/health/ready", "IsReady"},
+		{http.MethodGet, "/schemas/user", "GetIdentitySchema"},
+		{http.MethodGet, "/admin/courier/messages", "Other"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, nil)
+		if operation := kratosOperation(request); operation != test.operation {
+			t.Errorf(
+				"expected %s %s to be %s, got %s",
+				test.method, test.path, test.operation, operation,
+			)
+		}
+	}
+}
+
+func TestKratosMetricsTransport(t *testing.T) {
+	kratos := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			switch request.URL.Path {
+			case "/health/ready":
+				writer.WriteHeader(http.StatusOK)
+			case "/admin/identities":
+				time.Sleep(100 * time.Millisecond)
+			default:
+				writer.WriteHeader(http.StatusNotFound)
+			}
+		},
+	))
+	defer kratos.Close()
+	client := &http.Client{Transport: &KratosMetricsTransport{}}
+
+	tests := []struct {
+		method    string
+		path      string
+		timeout   time.Duration
+		operation string
+		class     string
+	}{
+		{http.MethodGet, "/health/ready", 0, "IsReady", KratosCallOk},
+		{http.MethodGet, "/admin/identities/42", 0, "GetIdentity", KratosCallNotFound},
+		{
+			http.MethodGet,
+			"/admin/identities",
+			10 * time.Millisecond,
+			"ListIdentities",
+			KratosCallTimeout,
+		},
+	}
+	for _, test := range tests {
+		before := testutil.ToFloat64(
+			base.KratosRequestsTotal.WithLabelValues(test.operation, test.class),
+		)
+		ctx := context.Background()
+		if test.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, test.timeout)
+			defer cancel()
+		}
+		request, _ := http.NewRequestWithContext(
+			ctx, test.method, kratos.URL+test.path, nil,
+		)
+		if response, err := client.Do(request); err == nil {
+			response.Body.Close()
+		}
+
+		count := testutil.ToFloat64(
+			base.KratosRequestsTotal.WithLabelValues(test.operation, test.class),
+		)
+		if count-before != 1 {
+			t.Errorf(
+				"expected call of %s with class %s, got %v",
+				test.operation, test.class, count-before,
+			)
+		}
+	}
+	// ids in path do not produce separate series
+	if base.KratosRequestDuration.DeleteLabelValues("/admin/identities/42") {
+		t.Error("unexpected series of path")
+	}
+}
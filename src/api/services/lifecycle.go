@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LifecycleService owns root context of background workers and shutdown
+// state of the service. Workers are started with Go and receive root
+// context, which is canceled by Stop.
+type LifecycleService struct {
+	ctx          context.Context
+	cancel       context.CancelFunc
+	shuttingDown atomic.Bool
+	draining     chan struct{}
+	mutex        sync.Mutex
+	workers      map[string]chan struct{}
+}
+
+func NewLifecycleService() *LifecycleService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LifecycleService{
+		ctx:      ctx,
+		cancel:   cancel,
+		draining: make(chan struct{}),
+		workers:  map[string]chan struct{}{},
+	}
+}
+
+// Context returns root context, which is canceled when workers are stopped.
+func (service *LifecycleService) Context() context.Context {
+	return service.ctx
+}
+
+// Go runs worker in a new goroutine with root context. Worker must return
+// after the context is canceled. Finished worker is forgotten, so short
+// lived workers can be started with unique names.
+func (service *LifecycleService) Go(name string, run func(ctx context.Context)) {
+	done := make(chan struct{})
+	service.mutex.Lock()
+	service.workers[name] = done
+	service.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			service.mutex.Lock()
+			if service.workers[name] == done {
+				delete(service.workers, name)
+			}
+			service.mutex.Unlock()
+			close(done)
+		}()
+		run(service.ctx)
+	}()
+}
+
+// BeginShutdown marks service as shutting down, so health check reports it
+// and long-lived requests like event streams are finished.
+func (service *LifecycleService) BeginShutdown() {
+	if service.shuttingDown.CompareAndSwap(false, true) {
+		close(service.draining)
+	}
+}
+
+func (service *LifecycleService) ShuttingDown() bool {
+	return service.shuttingDown.Load()
+}
+
+// Draining returns channel, which is closed when shutdown begins.
+func (service *LifecycleService) Draining() <-chan struct{} {
+	return service.draining
+}
+
+// Stop cancels root context and waits for workers up to timeout. It returns
+// sorted names of workers, which did not stop in time.
+func (service *LifecycleService) Stop(timeout time.Duration) []string {
+	service.BeginShutdown()
+	service.cancel()
+
+	service.mutex.Lock()
+	workers := make(map[string]chan struct{}, len(service.workers))
+	for name, done := range service.workers {
+		workers[name] = done
+	}
+	service.mutex.Unlock()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	expired := false
+	var running []string
+	for name, done := range workers {
+		select {
+		case <-done:
+			continue
+		default:
+		}
+		if !expired {
+			select {
+			case <-done:
+				continue
+			case <-deadline.C:
+				expired = true
+			}
+		}
+		running = append(running, name)
+	}
+	sort.Strings(running)
+	return running
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLifecycleStop(t *testing.T) {
+	lifecycle := NewLifecycleService()
+	finished := make(chan struct{})
+	lifecycle.Go("short", func(context.Context) { close(finished) })
+	<-finished
+	lifecycle.Go("graceful", func(ctx context.Context) { <-ctx.Done() })
+	lifecycle.Go("stuck", func(context.Context) { select {} })
+
+	running := lifecycle.Stop(50 * time.Millisecond)
+	if len(running) != 1 || running[0] != "stuck" {
+		t.Errorf("expected only stuck worker running, got %v", running)
+	}
+	lifecycle.mutex.Lock()
+	defer lifecycle.mutex.Unlock()
+	if _, ok := lifecycle.workers["short"]; ok {
+		t.Error("finished worker is kept")
+	}
+}
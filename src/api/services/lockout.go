@@ -0,0 +1,85 @@
+package services
+
+import (
+	"access-backend/base"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+type BaseLockoutService interface {
+	Check(keys ...string) (time.Duration, error)
+	RegisterFailure(clientIp string, keys ...string) (time.Duration, error)
+	RegisterSuccess(keys ...string) error
+}
+
+// LockoutService applies exponentially growing lockouts to keys (client
+// IPs, credentials) after too many failed authentication attempts.
+type LockoutService struct {
+	BaseLockoutService
+	LockoutConfig *base.LockoutConfig
+	Store         AttemptsStore
+}
+
+func (service *LockoutService) Check(keys ...string) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		lockedUntil, err := service.Store.LockedUntil(key)
+		if err != nil {
+			return 0, err
+		}
+		if delay := time.Until(lockedUntil); delay > retryAfter {
+			retryAfter = delay
+		}
+	}
+	return retryAfter, nil
+}
+
+func (service *LockoutService) lockoutDelay(failures int64) time.Duration {
+	exceeded := failures - service.LockoutConfig.MaxFailures
+	if exceeded < 0 {
+		return 0
+	}
+	delay := service.LockoutConfig.BaseDelay
+	for i := int64(0); i < exceeded && delay < service.LockoutConfig.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, service.LockoutConfig.MaxDelay)
+}
+
+func (service *LockoutService) RegisterFailure(
+	clientIp string, keys ...string,
+) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		failures, err := service.Store.AddFailure(
+			key, service.LockoutConfig.Window,
+		)
+		if err != nil {
+			return 0, err
+		}
+		delay := service.lockoutDelay(failures)
+		if delay == 0 {
+			continue
+		}
+		if err = service.Store.Lock(key, time.Now().Add(delay)); err != nil {
+			return 0, err
+		}
+		base.Logger.WithFields(logrus.Fields{
+			"client_ip": clientIp,
+			"key":       key,
+			"failures":  failures,
+			"delay":     delay.String(),
+		}).Warn("Authentication locked out")
+		retryAfter = max(retryAfter, delay)
+	}
+	return retryAfter, nil
+}
+
+func (service *LockoutService) RegisterSuccess(keys ...string) error {
+	for _, key := range keys {
+		if err := service.Store.Reset(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// signalActor is actor of audit events of level changed by signal.
+const signalActor string = "signal"
+
+type BaseLogLevelService interface {
+	GetLevel() *api.LogLevelResponse
+	SetLevel(
+		request *api.LogLevelRequest, event *api.AuditEvent,
+	) (*api.LogLevelResponse, error)
+}
+
+// LogLevelService changes level of logger at runtime. Changed level is
+// reverted to configured one after TTL, every change is audited.
+type LogLevelService struct {
+	LogConfig    *base.LogConfig
+	Logger       *logrus.Logger
+	AuditService BaseAuditService
+	mutex        sync.Mutex
+	revertTimer  *time.Timer
+	revertAt     *time.Time
+	// generation is increased on every change, so timer of replaced
+	// change does not revert level
+	generation int64
+}
+
+// logLevelState is audited state of logger.
+type logLevelState struct {
+	Level string `json:"level"`
+}
+
+func (service *LogLevelService) defaultLevel() logrus.Level {
+	level, err := logrus.ParseLevel(service.LogConfig.Level)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return level
+}
+
+func (service *LogLevelService) response() *api.LogLevelResponse {
+	return &api.LogLevelResponse{
+		Level:        base.LogLevel(service.Logger).String(),
+		DefaultLevel: service.defaultLevel().String(),
+		RevertAt:     service.revertAt,
+	}
+}
+
+func (service *LogLevelService) GetLevel() *api.LogLevelResponse {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	return service.response()
+}
+
+// SetLevel changes level, which is reverted after requested TTL or after
+// maximal TTL, if it is configured.
+func (service *LogLevelService) SetLevel(
+	request *api.LogLevelRequest, event *api.AuditEvent,
+) (*api.LogLevelResponse, error) {
+	level, err := logrus.ParseLevel(request.Level)
+	if err != nil {
+		return nil, base.ServiceError{
+			Summary: fmt.Sprintf("Invalid log level '%s'", request.Level),
+			Status:  http.StatusBadRequest,
+		}
+	}
+	ttl := time.Duration(request.Ttl) * time.Second
+	maxTtl := service.LogConfig.MaxLevelTtl
+	if maxTtl > 0 && ttl > maxTtl {
+		return nil, base.ServiceError{
+			Summary: fmt.Sprintf(
+				"Log level TTL can not exceed %d seconds",
+				int64(maxTtl.Seconds()),
+			),
+			Status: http.StatusUnprocessableEntity,
+		}
+	}
+	if ttl == 0 {
+		ttl = maxTtl
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.change(level, ttl, event)
+	return service.response(), nil
+}
+
+// change sets level and schedules reverting it, mutex must be locked.
+func (service *LogLevelService) change(
+	level logrus.Level, ttl time.Duration, event *api.AuditEvent,
+) {
+	before := base.LogLevel(service.Logger)
+	base.SetLogLevel(service.Logger, level)
+
+	service.generation++
+	if service.revertTimer != nil {
+		service.revertTimer.Stop()
+		service.revertTimer = nil
+	}
+	service.revertAt = nil
+	if ttl > 0 && level != service.defaultLevel() {
+		revertAt := time.Now().UTC().Add(ttl).Round(time.Millisecond)
+		generation := service.generation
+		service.revertAt = &revertAt
+		service.revertTimer = time.AfterFunc(ttl, func() {
+			service.revert(generation)
+		})
+	}
+
+	fields := logrus.Fields{
+		"before": before.String(),
+		"after":  level.String(),
+		"actor":  event.Actor,
+	}
+	if service.revertAt != nil {
+		fields["revert_at"] = service.revertAt.Format(time.RFC3339)
+	}
+	service.Logger.WithFields(fields).Warn("Log level changed")
+
+	if service.AuditService == nil {
+		return
+	}
+	event.Action = base.ChangeLogLevelAction
+	if event.Status == 0 {
+		event.Status = http.StatusOK
+	}
+	service.AuditService.Record(
+		event,
+		logLevelState{Level: before.String()},
+		logLevelState{Level: level.String()},
+	)
+}
+
+func (service *LogLevelService) revert(generation int64) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if generation != service.generation {
+		return
+	}
+	service.change(service.defaultLevel(), 0, &api.AuditEvent{Actor: "system"})
+}
+
+// step makes level more verbose for positive delta or less verbose for
+// negative one, within error and trace levels.
+func (service *LogLevelService) step(delta int) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	current := base.LogLevel(service.Logger)
+	level := logrus.Level(
+		min(max(int(current)+delta, int(logrus.ErrorLevel)), int(logrus.TraceLevel)),
+	)
+	if level == current {
+		return
+	}
+	service.change(
+		level, service.LogConfig.SignalLevelTtl, &api.AuditEvent{Actor: signalActor},
+	)
+}
+
+// Watch makes level more verbose on SIGUSR1 and less verbose on SIGUSR2,
+// until context is canceled.
+func (service *LogLevelService) Watch(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			service.mutex.Lock()
+			if service.revertTimer != nil {
+				service.revertTimer.Stop()
+			}
+			service.mutex.Unlock()
+			return
+		case received := <-signals:
+			if received == syscall.SIGUSR1 {
+				service.step(1)
+			} else {
+				service.step(-1)
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestLogLevelService() (*LogLevelService, *recordingAuditService) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.InfoLevel)
+	audit := &recordingAuditService{}
+	return &LogLevelService{
+		LogConfig: &base.LogConfig{
+			Level:          "info",
+			MaxLevelTtl:    time.Hour,
+			SignalLevelTtl: time.Hour,
+		},
+		Logger:       logger,
+		AuditService: audit,
+	}, audit
+}
+
+// changeLevel changes level with TTL shorter than API allows.
+func changeLevel(service *LogLevelService, level logrus.Level, ttl time.Duration) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.change(level, ttl, &api.AuditEvent{Actor: "admin"})
+}
+
+func waitLevel(t *testing.T, service *LogLevelService, level logrus.Level) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		if service.GetLevel().Level == level.String() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected level %s, got %s", level, service.GetLevel().Level)
+}
+
+func TestLogLevelTtlRevert(t *testing.T) {
+	service, audit := newTestLogLevelService()
+	changeLevel(service, logrus.DebugLevel, 20*time.Millisecond)
+	if response := service.GetLevel(); response.Level != "debug" || response.RevertAt == nil {
+		t.Fatalf("expected debug level with revert time, got %+v", response)
+	}
+
+	waitLevel(t, service, logrus.InfoLevel)
+	if response := service.GetLevel(); response.RevertAt != nil {
+		t.Errorf("unexpected revert time after revert %v", response.RevertAt)
+	}
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	if len(audit.events) != 2 || audit.events[1].Actor != "system" {
+		t.Errorf("expected audited change and revert, got %+v", audit.events)
+	}
+}
+
+func TestLogLevelChangeReplacesRevert(t *testing.T) {
+	service, _ := newTestLogLevelService()
+	changeLevel(service, logrus.DebugLevel, 20*time.Millisecond)
+	generation := service.generation
+	changeLevel(service, logrus.WarnLevel, time.Hour)
+
+	// timer of replaced change does not revert level
+	time.Sleep(50 * time.Millisecond)
+	service.revert(generation)
+	if level := service.GetLevel().Level; level != "warning" {
+		t.Errorf("expected replacing level to stay, got %s", level)
+	}
+
+	// level equal to configured one is not reverted
+	changeLevel(service, logrus.InfoLevel, 20*time.Millisecond)
+	if response := service.GetLevel(); response.RevertAt != nil {
+		t.Errorf("unexpected revert of configured level %v", response.RevertAt)
+	}
+}
+
+func TestLogLevelSignalStep(t *testing.T) {
+	service, audit := newTestLogLevelService()
+	steps := []struct {
+		delta int
+		level logrus.Level
+	}{
+		{1, logrus.DebugLevel},
+		{1, logrus.TraceLevel},
+		{1, logrus.TraceLevel},
+		{-1, logrus.DebugLevel},
+		{-1, logrus.InfoLevel},
+		{-1, logrus.WarnLevel},
+		{-1, logrus.ErrorLevel},
+		{-1, logrus.ErrorLevel},
+	}
+	for _, step := range steps {
+		service.step(step.delta)
+		if level := service.GetLevel().Level; level != step.level.String() {
+			t.Fatalf("expected level %s, got %s", step.level, level)
+		}
+	}
+
+	// unchanged levels at limits are not audited
+	audit.mutex.Lock()
+	defer audit.mutex.Unlock()
+	if len(audit.events) != len(steps)-2 {
+		t.Errorf("expected %d audit events, got %d", len(steps)-2, len(audit.events))
+	}
+	for _, event := range audit.events {
+		if event.Actor != signalActor || event.Action != base.ChangeLogLevelAction {
+			t.Errorf("unexpected audit event %+v", event)
+		}
+	}
+	if service.GetLevel().RevertAt == nil {
+		t.Error("expected signal level to be reverted after TTL")
+	}
+}
+
+func TestSetLogLevelValidation(t *testing.T) {
+	service, _ := newTestLogLevelService()
+	tests := []struct {
+		request api.LogLevelRequest
+		status  int
+	}{
+		{api.LogLevelRequest{Level: "verbose"}, http.StatusBadRequest},
+		{api.LogLevelRequest{Level: "debug", Ttl: 7200}, http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		_, err := service.SetLevel(&test.request, &api.AuditEvent{Actor: "admin"})
+		if status := base.ErrorStatus(err); status != test.status {
+			t.Errorf("expected status %d for %+v, got %d", test.status, test.request, status)
+		}
+	}
+
+	// maximal TTL applies to level without TTL
+	response, err := service.SetLevel(
+		&api.LogLevelRequest{Level: "debug"}, &api.AuditEvent{Actor: "admin"},
+	)
+	if err != nil || response.RevertAt == nil {
+		t.Errorf("expected level reverted after maximal TTL, got %+v", response)
+	}
+	service.revertTimer.Stop()
+}
@@ -0,0 +1,493 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxRecord is user event waiting for publishing to broker.
+type OutboxRecord struct {
+	Id    int64         `json:"id"`
+	Event api.UserEvent `json:"event"`
+}
+
+// OutboxPublishFunc publishes records in order and returns number of
+// records published before the first failure.
+type OutboxPublishFunc func(records []OutboxRecord) int
+
+// OutboxStore durably keeps user events until they are published. Drain
+// passes at most limit pending records ordered by id to publish and
+// removes published ones. Only one Drain runs at a time, even if store is
+// shared by several service instances.
+type OutboxStore interface {
+	Append(ctx context.Context, event *api.UserEvent) error
+	Drain(limit int, publish OutboxPublishFunc) (int, error)
+	Pending() (int64, error)
+	// Ping checks that storage is reachable
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type fileOutboxEntry struct {
+	Record *OutboxRecord `json:"record,omitempty"`
+	Acked  int64         `json:"acked,omitempty"`
+}
+
+// FileOutboxStore appends records and acknowledgements of published
+// records to file as JSON lines. Pending records are kept in memory, file
+// is truncated when all of them are published.
+type FileOutboxStore struct {
+	OutboxStore
+	mutex   sync.Mutex
+	drain   sync.Mutex
+	file    *os.File
+	pending []OutboxRecord
+	lastId  int64
+}
+
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"outbox file '%s' open error. %s", path, err.Error(),
+		)
+	}
+
+	store := &FileOutboxStore{file: file}
+	if err = store.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf(
+			"outbox file '%s' reading error, invalid format. %s",
+			path,
+			err.Error(),
+		)
+	}
+	return store, nil
+}
+
+func (store *FileOutboxStore) load() error {
+	scanner := bufio.NewScanner(store.file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry fileOutboxEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return err
+		}
+		if entry.Record != nil {
+			store.pending = append(store.pending, *entry.Record)
+			store.lastId = entry.Record.Id
+		}
+		store.ack(entry.Acked)
+	}
+	return scanner.Err()
+}
+
+func (store *FileOutboxStore) ack(lastId int64) {
+	published := 0
+	for published < len(store.pending) && store.pending[published].Id <= lastId {
+		published++
+	}
+	store.pending = store.pending[published:]
+}
+
+func (store *FileOutboxStore) write(entry *fileOutboxEntry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err = store.file.Write(append(content, '\n')); err != nil {
+		return err
+	}
+	return store.file.Sync()
+}
+
+func (store *FileOutboxStore) Append(
+	_ context.Context, event *api.UserEvent,
+) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	record := OutboxRecord{Id: store.lastId + 1, Event: *event}
+	if err := store.write(&fileOutboxEntry{Record: &record}); err != nil {
+		return err
+	}
+	store.lastId = record.Id
+	store.pending = append(store.pending, record)
+	return nil
+}
+
+func (store *FileOutboxStore) Drain(limit int, publish OutboxPublishFunc) (
+	int, error,
+) {
+	store.drain.Lock()
+	defer store.drain.Unlock()
+
+	store.mutex.Lock()
+	records := store.pending[:min(limit, len(store.pending))]
+	store.mutex.Unlock()
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	published := publish(records)
+	if published == 0 {
+		return 0, nil
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.ack(records[published-1].Id)
+	if len(store.pending) == 0 {
+		return published, store.file.Truncate(0)
+	}
+	return published, store.write(
+		&fileOutboxEntry{Acked: records[published-1].Id},
+	)
+}
+
+func (store *FileOutboxStore) Pending() (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return int64(len(store.pending)), nil
+}
+
+func (store *FileOutboxStore) Ping(context.Context) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	_, err := store.file.Stat()
+	return err
+}
+
+func (store *FileOutboxStore) Close() error {
+	return store.file.Close()
+}
+
+// PostgresOutboxStore keeps pending records in PostgreSQL table, which is
+// created on start if it does not exist. Published records are deleted.
+type PostgresOutboxStore struct {
+	OutboxStore
+	db *sql.DB
+}
+
+// outboxDrainLockId is PostgreSQL advisory lock key, which allows only one
+// service instance to publish events.
+const outboxDrainLockId int64 = 7216541902
+
+func NewPostgresOutboxStore(dsn string) (*PostgresOutboxStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("outbox database open error. %s", err.Error())
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS outbox_events (
+		id BIGSERIAL PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		event JSONB NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("outbox table creation error. %s", err.Error())
+	}
+	return &PostgresOutboxStore{db: db}, nil
+}
+
+func (store *PostgresOutboxStore) Append(
+	ctx context.Context, event *api.UserEvent,
+) error {
+	content, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = store.db.ExecContext(
+		ctx,
+		"INSERT INTO outbox_events (user_id, event) VALUES ($1, $2)",
+		event.UserId,
+		content,
+	)
+	return err
+}
+
+// Drain holds session advisory lock on dedicated connection while records
+// are published, so no transaction is kept open during publishing.
+func (store *PostgresOutboxStore) Drain(limit int, publish OutboxPublishFunc) (
+	int, error,
+) {
+	ctx := context.Background()
+	conn, err := store.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err = conn.QueryRowContext(
+		ctx, "SELECT pg_try_advisory_lock($1)", outboxDrainLockId,
+	).Scan(&locked); err != nil || !locked {
+		return 0, err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", outboxDrainLockId)
+
+	records, err := store.pending(ctx, conn, limit)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+
+	published := publish(records)
+	if published == 0 {
+		return 0, nil
+	}
+	if _, err = conn.ExecContext(
+		ctx, "DELETE FROM outbox_events WHERE id <= $1", records[published-1].Id,
+	); err != nil {
+		return 0, err
+	}
+	return published, nil
+}
+
+func (store *PostgresOutboxStore) pending(
+	ctx context.Context, conn *sql.Conn, limit int,
+) ([]OutboxRecord, error) {
+	rows, err := conn.QueryContext(
+		ctx, "SELECT id, event FROM outbox_events ORDER BY id LIMIT $1", limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]OutboxRecord, 0, limit)
+	for rows.Next() {
+		var record OutboxRecord
+		var content []byte
+		if err = rows.Scan(&record.Id, &content); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(content, &record.Event); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (store *PostgresOutboxStore) Pending() (int64, error) {
+	var count int64
+	err := store.db.QueryRow("SELECT count(*) FROM outbox_events").Scan(&count)
+	return count, err
+}
+
+func (store *PostgresOutboxStore) Ping(ctx context.Context) error {
+	return store.db.PingContext(ctx)
+}
+
+func (store *PostgresOutboxStore) Close() error {
+	return store.db.Close()
+}
+
+// OutboxService buffers user events in memory, records them in outbox
+// store and publishes them to broker in background, so slow store does not
+// block requests. Events are recorded and published in order and
+// publishing stops at the first failure, so events of every user are
+// delivered at least once and in order. Events failed to be recorded stay
+// in the buffer and are recorded again before publishing.
+type OutboxService struct {
+	OutboxConfig *base.OutboxConfig
+	Store        OutboxStore
+	Broker       Broker
+	notify       chan struct{}
+	mutex        sync.Mutex
+	unrecorded   []api.UserEvent
+}
+
+func NewOutboxService(
+	config *base.OutboxConfig, store OutboxStore, broker Broker,
+) *OutboxService {
+	return &OutboxService{
+		OutboxConfig: config,
+		Store:        store,
+		Broker:       broker,
+		notify:       make(chan struct{}, 1),
+	}
+}
+
+// HandleEvent adds event to the buffer and wakes up publisher, store is
+// not called.
+func (service *OutboxService) HandleEvent(event *api.UserEvent) {
+	service.mutex.Lock()
+	full := len(service.unrecorded) >= service.OutboxConfig.RetryBufferSize
+	if !full {
+		service.unrecorded = append(service.unrecorded, *event)
+	}
+	service.mutex.Unlock()
+
+	if full {
+		base.Logger.WithFields(logrus.Fields{
+			"event_id":   event.Id,
+			"event_type": event.Type,
+			"user_id":    event.UserId,
+		}).Error("Outbox buffer is full, event dropped")
+		return
+	}
+	select {
+	case service.notify <- struct{}{}:
+	default:
+	}
+}
+
+// recordUnrecorded records buffered events in order and stops at the
+// first failure. It is called only by publisher, so the first buffered
+// event is not changed while it is recorded without lock.
+func (service *OutboxService) recordUnrecorded(ctx context.Context) error {
+	for {
+		service.mutex.Lock()
+		if len(service.unrecorded) == 0 {
+			service.unrecorded = nil
+			service.mutex.Unlock()
+			return nil
+		}
+		event := service.unrecorded[0]
+		service.mutex.Unlock()
+
+		recordCtx, cancel := context.WithTimeout(
+			ctx, service.OutboxConfig.RecordTimeout,
+		)
+		err := service.Store.Append(recordCtx, &event)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("outbox event recording error. %s", err.Error())
+		}
+
+		service.mutex.Lock()
+		service.unrecorded = service.unrecorded[1:]
+		service.mutex.Unlock()
+	}
+}
+
+// QueueDepth returns number of events waiting for publishing.
+func (service *OutboxService) QueueDepth() int64 {
+	service.mutex.Lock()
+	unrecorded := int64(len(service.unrecorded))
+	service.mutex.Unlock()
+
+	pending, err := service.Store.Pending()
+	if err != nil {
+		return unrecorded
+	}
+	return pending + unrecorded
+}
+
+// publishPending records buffered events and publishes pending events
+// until outbox is empty or publishing fails.
+func (service *OutboxService) publishPending(ctx context.Context) error {
+	if err := service.recordUnrecorded(ctx); err != nil {
+		return err
+	}
+	for {
+		var publishErr error
+		published, err := service.Store.Drain(
+			service.OutboxConfig.BatchSize,
+			func(records []OutboxRecord) int {
+				for i := range records {
+					publishErr = service.publish(ctx, &records[i].Event)
+					if publishErr != nil {
+						return i
+					}
+				}
+				return len(records)
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if publishErr != nil {
+			return publishErr
+		}
+		if published < service.OutboxConfig.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (service *OutboxService) publish(
+	ctx context.Context, event *api.UserEvent,
+) error {
+	publishCtx, cancel := context.WithTimeout(
+		ctx, service.OutboxConfig.PublishTimeout,
+	)
+	defer cancel()
+	return service.Broker.Publish(publishCtx, event)
+}
+
+// Run publishes recorded events until context is canceled. On cancellation
+// pending events are published within shutdown timeout and broker is
+// closed.
+func (service *OutboxService) Run(ctx context.Context) {
+	wait := time.Duration(0)
+	backoff := time.Duration(0)
+	for {
+		// New events do not interrupt backoff after publishing failure
+		notify := service.notify
+		if backoff > 0 {
+			notify = nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			service.shutdown()
+			return
+		case <-notify:
+		case <-timer.C:
+		}
+		timer.Stop()
+
+		if err := service.publishPending(ctx); err != nil {
+			backoff = min(
+				max(backoff*2, service.OutboxConfig.InitialBackoff),
+				service.OutboxConfig.MaxBackoff,
+			)
+			wait = backoff
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+				"retry": backoff.String(),
+			}).Warn("Outbox publishing error")
+			continue
+		}
+		backoff = 0
+		wait = service.OutboxConfig.PollInterval
+	}
+}
+
+func (service *OutboxService) shutdown() {
+	ctx, cancel := context.WithTimeout(
+		context.Background(), service.OutboxConfig.ShutdownTimeout,
+	)
+	defer cancel()
+
+	if err := service.publishPending(ctx); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Warn("Outbox events were not published before shutdown")
+	}
+	if err := service.Broker.Close(); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Warn("Broker closing error")
+	}
+}
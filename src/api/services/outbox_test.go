@@ -0,0 +1,144 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flakyOutboxStore fails appending while failing is true and waits for
+// blocked channel or context, if it is set.
+type flakyOutboxStore struct {
+	*FileOutboxStore
+	failing bool
+	blocked chan struct{}
+}
+
+func (store *flakyOutboxStore) Append(
+	ctx context.Context, event *api.UserEvent,
+) error {
+	if store.blocked != nil {
+		select {
+		case <-store.blocked:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if store.failing {
+		return errors.New("store is unavailable")
+	}
+	return store.FileOutboxStore.Append(ctx, event)
+}
+
+type recordingBroker struct {
+	published []string
+}
+
+func (broker *recordingBroker) Publish(
+	_ context.Context, event *api.UserEvent,
+) error {
+	broker.published = append(broker.published, event.Id)
+	return nil
+}
+
+func (broker *recordingBroker) Close() error {
+	return nil
+}
+
+func newTestOutboxService(t *testing.T) (
+	*OutboxService, *flakyOutboxStore, *recordingBroker,
+) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	fileStore, err := NewFileOutboxStore(path)
+	if err != nil {
+		t.Fatalf("outbox store error: %s", err)
+	}
+	t.Cleanup(func() { fileStore.Close() })
+	store := &flakyOutboxStore{FileOutboxStore: fileStore}
+	broker := &recordingBroker{}
+	config := &base.OutboxConfig{
+		BatchSize:       2,
+		PublishTimeout:  time.Second,
+		RetryBufferSize: 3,
+		RecordTimeout:   50 * time.Millisecond,
+	}
+	return NewOutboxService(config, store, broker), store, broker
+}
+
+func TestOutboxRetriesRecording(t *testing.T) {
+	service, store, broker := newTestOutboxService(t)
+
+	service.HandleEvent(&api.UserEvent{Id: "1"})
+	service.HandleEvent(&api.UserEvent{Id: "2"})
+	service.HandleEvent(&api.UserEvent{Id: "3"})
+	if depth := service.QueueDepth(); depth != 3 {
+		t.Fatalf("expected queue depth 3, got %d", depth)
+	}
+
+	store.failing = true
+	if err := service.publishPending(context.Background()); err == nil {
+		t.Fatal("expected recording error")
+	}
+	store.failing = false
+	if err := service.publishPending(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []string{"1", "2", "3"}
+	if len(broker.published) != len(expected) {
+		t.Fatalf("expected %v published, got %v", expected, broker.published)
+	}
+	for i := range expected {
+		if broker.published[i] != expected[i] {
+			t.Fatalf("expected %v published, got %v", expected, broker.published)
+		}
+	}
+	if depth := service.QueueDepth(); depth != 0 {
+		t.Errorf("expected empty queue, got %d", depth)
+	}
+}
+
+func TestOutboxRetryBufferLimit(t *testing.T) {
+	service, _, _ := newTestOutboxService(t)
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		service.HandleEvent(&api.UserEvent{Id: id})
+	}
+	if depth := service.QueueDepth(); depth != 3 {
+		t.Errorf("expected 3 events kept, got %d", depth)
+	}
+}
+
+func TestOutboxBlockedStoreDoesNotBlockPublish(t *testing.T) {
+	service, store, broker := newTestOutboxService(t)
+	store.blocked = make(chan struct{})
+	events := &EventDispatcher{}
+	events.Subscribe(service)
+
+	published := make(chan struct{})
+	go func() {
+		events.Publish(base.UserCreatedEvent, "42", nil)
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publishing is blocked by outbox store")
+	}
+
+	// recording by publisher times out
+	if err := service.publishPending(context.Background()); err == nil {
+		t.Fatal("expected recording timeout")
+	}
+	close(store.blocked)
+	if err := service.publishPending(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(broker.published) != 1 {
+		t.Errorf("expected event published, got %v", broker.published)
+	}
+}
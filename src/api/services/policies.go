@@ -0,0 +1,228 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"fmt"
+	"github.com/google/cel-go/cel"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type PolicyRule struct {
+	Name      string `yaml:"name"`
+	Message   string `yaml:"message"`
+	Condition string `yaml:"condition"`
+}
+
+type PolicyFile struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+type compiledRule struct {
+	PolicyRule
+	program cel.Program
+}
+
+type BasePolicyService interface {
+	Evaluate(input *api.PolicyInput) (*api.PolicyDecision, error)
+}
+
+// PolicyService evaluates CEL deny rules loaded from policy files. Request
+// is denied by the first rule which condition evaluates to true.
+type PolicyService struct {
+	BasePolicyService
+	PolicyConfig *base.PolicyConfig
+	mutex        sync.RWMutex
+	rules        []compiledRule
+	modTimes     map[string]time.Time
+}
+
+func newPolicyEnvironment() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("caller", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("route", cel.StringType),
+		cel.Variable("method", cel.StringType),
+		cel.Variable("params", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("target", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("now", cel.TimestampType),
+	)
+}
+
+func compileRules(env *cel.Env, file string) ([]compiledRule, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("policy file '%s' open error. %s", file, err.Error())
+	}
+	var policyFile PolicyFile
+	if err = yaml.Unmarshal(content, &policyFile); err != nil {
+		return nil, fmt.Errorf(
+			"policy file '%s' reading error, invalid format. %s",
+			file,
+			err.Error(),
+		)
+	}
+
+	rules := make([]compiledRule, 0, len(policyFile.Rules))
+	for _, rule := range policyFile.Rules {
+		ast, issues := env.Compile(rule.Condition)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf(
+				"policy rule '%s' compile error. %s", rule.Name, issues.Err(),
+			)
+		}
+		if !ast.OutputType().IsExactType(cel.BoolType) {
+			return nil, fmt.Errorf(
+				"policy rule '%s' condition must be boolean", rule.Name,
+			)
+		}
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"policy rule '%s' compile error. %s", rule.Name, err.Error(),
+			)
+		}
+		rules = append(rules, compiledRule{PolicyRule: rule, program: program})
+	}
+	return rules, nil
+}
+
+func (service *PolicyService) readModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(service.PolicyConfig.Files))
+	for _, file := range service.PolicyConfig.Files {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func (service *PolicyService) Load() error {
+	env, err := newPolicyEnvironment()
+	if err != nil {
+		return err
+	}
+
+	modTimes := service.readModTimes()
+	var rules []compiledRule
+	for _, file := range service.PolicyConfig.Files {
+		fileRules, err := compileRules(env, file)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.rules = rules
+	service.modTimes = modTimes
+
+	base.Logger.WithFields(logrus.Fields{
+		"rules": len(rules),
+	}).Info("Policies loaded")
+	return nil
+}
+
+func (service *PolicyService) changed() bool {
+	modTimes := service.readModTimes()
+
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+	if len(modTimes) != len(service.modTimes) {
+		return true
+	}
+	for file, modTime := range modTimes {
+		if !service.modTimes[file].Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads policies when any of policy files changes. Invalid policy
+// files are reported and previously loaded rules stay in effect.
+func (service *PolicyService) Watch(ctx context.Context) {
+	ticker := time.NewTicker(service.PolicyConfig.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !service.changed() {
+				continue
+			}
+			if err := service.Load(); err != nil {
+				base.Logger.WithFields(logrus.Fields{
+					"error": err.Error(),
+				}).Error("Error reloading policies")
+			}
+		}
+	}
+}
+
+func policyActivation(input *api.PolicyInput) map[string]any {
+	caller := map[string]any{}
+	if input.Caller != nil {
+		permissions := make([]string, 0, len(input.Caller.Permissions))
+		for _, permission := range input.Caller.Permissions {
+			permissions = append(permissions, string(permission))
+		}
+		caller["name"] = input.Caller.Name
+		caller["role"] = input.Caller.Role
+		caller["permissions"] = permissions
+	}
+	params := input.Params
+	if params == nil {
+		params = map[string]string{}
+	}
+	target := input.Target
+	if target == nil {
+		target = map[string]any{}
+	}
+
+	return map[string]any{
+		"caller": caller,
+		"route":  input.Route,
+		"method": input.Method,
+		"params": params,
+		"target": target,
+		"now":    time.Now(),
+	}
+}
+
+func (service *PolicyService) Evaluate(input *api.PolicyInput) (
+	*api.PolicyDecision, error,
+) {
+	service.mutex.RLock()
+	rules := service.rules
+	service.mutex.RUnlock()
+
+	activation := policyActivation(input)
+	for _, rule := range rules {
+		result, _, err := rule.program.Eval(activation)
+		if err != nil {
+			return nil, base.ServiceError{
+				Summary: fmt.Sprintf("Policy rule '%s' evaluation error", rule.Name),
+				Detail:  err.Error(),
+				Status:  http.StatusInternalServerError,
+			}
+		}
+		if denied, ok := result.Value().(bool); ok && denied {
+			return &api.PolicyDecision{
+				Allowed: false,
+				Rule:    &rule.Name,
+				Message: &rule.Message,
+			}, nil
+		}
+	}
+
+	return &api.PolicyDecision{Allowed: true}, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPolicies = `
+rules:
+  - name: "no-deletes"
+    message: "Users can not be deleted"
+    condition: method == "DELETE" && route == "/v1/users/:user_id"
+  - name: "customer-a-only"
+    message: "Support can manage only users of customer A"
+    condition: >
+      caller.role == "support" && has(target.traits) &&
+      !target.traits.email.endsWith("@customer-a.com")
+`
+
+func writePolicyFile(t *testing.T, file string, content string) {
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("policy file error: %s", err)
+	}
+}
+
+func newTestPolicyService(t *testing.T, content string) *PolicyService {
+	file := filepath.Join(t.TempDir(), "policies.yaml")
+	writePolicyFile(t, file, content)
+	return &PolicyService{PolicyConfig: &base.PolicyConfig{
+		Enabled:        true,
+		Files:          []string{file},
+		ReloadInterval: 10 * time.Millisecond,
+	}}
+}
+
+func deniedBy(decision *api.PolicyDecision) string {
+	if decision.Allowed {
+		return ""
+	}
+	return *decision.Rule
+}
+
+func TestPolicyEvaluation(t *testing.T) {
+	service := newTestPolicyService(t, testPolicies)
+	if err := service.Load(); err != nil {
+		t.Fatalf("policies loading error: %s", err)
+	}
+
+	supportTarget := func(email string) map[string]any {
+		return map[string]any{
+			"id":     "42",
+			"traits": map[string]any{string(base.Email): email},
+		}
+	}
+	tests := []struct {
+		name   string
+		input  api.PolicyInput
+		denied string
+	}{
+		{
+			name:   "delete denied",
+			input:  api.PolicyInput{Route: "/v1/users/:user_id", Method: "DELETE"},
+			denied: "no-deletes",
+		},
+		{
+			name:  "other route allowed",
+			input: api.PolicyInput{Route: "/v1/webhooks/:webhook_id", Method: "DELETE"},
+		},
+		{
+			name: "support target of customer allowed",
+			input: api.PolicyInput{
+				Caller: &api.PolicyCaller{Name: "support", Role: "support"},
+				Route:  "/v1/users/:user_id/deactivate",
+				Method: "POST",
+				Target: supportTarget("user@customer-a.com"),
+			},
+		},
+		{
+			name: "support target of other customer denied",
+			input: api.PolicyInput{
+				Caller: &api.PolicyCaller{Name: "support", Role: "support"},
+				Route:  "/v1/users/:user_id/deactivate",
+				Method: "POST",
+				Target: supportTarget("user@customer-b.com"),
+			},
+			denied: "customer-a-only",
+		},
+		{
+			name: "support without target allowed",
+			input: api.PolicyInput{
+				Caller: &api.PolicyCaller{Name: "support", Role: "support"},
+				Route:  "/v1/webhooks",
+				Method: "GET",
+			},
+		},
+		{
+			name: "admin target of other customer allowed",
+			input: api.PolicyInput{
+				Caller: &api.PolicyCaller{Name: "root", Role: base.AdminRole},
+				Route:  "/v1/users/:user_id/deactivate",
+				Method: "POST",
+				Target: supportTarget("user@customer-b.com"),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision, err := service.Evaluate(&test.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", base.ErrorStatus(err))
+			}
+			if rule := deniedBy(decision); rule != test.denied {
+				t.Errorf("expected denial by %q, got %q", test.denied, rule)
+			}
+			if !decision.Allowed && *decision.Message == "" {
+				t.Error("denial without message")
+			}
+		})
+	}
+}
+
+func TestPolicyTypeMismatch(t *testing.T) {
+	for _, condition := range []string{`route`, `caller.role`, `params`} {
+		service := newTestPolicyService(
+			t, "rules:\n  - name: invalid\n    condition: "+condition+"\n",
+		)
+		err := service.Load()
+		if err == nil || !strings.Contains(err.Error(), "must be boolean") {
+			t.Errorf("expected non-boolean error of %q, got %v", condition, err)
+		}
+	}
+
+	// target values are dynamic, so type mismatch is detected on evaluation
+	service := newTestPolicyService(
+		t, "rules:\n  - name: mismatch\n    condition: target.count > 1\n",
+	)
+	if err := service.Load(); err != nil {
+		t.Fatalf("policies loading error: %s", err)
+	}
+	_, err := service.Evaluate(&api.PolicyInput{
+		Route:  "/v1/users/:user_id",
+		Method: "GET",
+		Target: map[string]any{"count": "many"},
+	})
+	if status := base.ErrorStatus(err); status != http.StatusInternalServerError {
+		t.Errorf("expected evaluation error, got status %d", status)
+	}
+}
+
+func TestPolicyReload(t *testing.T) {
+	service := newTestPolicyService(t, testPolicies)
+	if err := service.Load(); err != nil {
+		t.Fatalf("policies loading error: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.Watch(ctx)
+
+	input := &api.PolicyInput{Route: "/v1/users/:user_id", Method: "DELETE"}
+	waitDenial := func(expected string) {
+		t.Helper()
+		var rule string
+		for start := time.Now(); time.Since(start) < 5*time.Second; {
+			decision, err := service.Evaluate(input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", base.ErrorStatus(err))
+			}
+			if rule = deniedBy(decision); rule == expected {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("expected denial by %q, got %q", expected, rule)
+	}
+	file := service.PolicyConfig.Files[0]
+	version := 0
+	touch := func(content string) {
+		writePolicyFile(t, file, content)
+		// modification time may not change on fast writes
+		version++
+		modTime := time.Now().Add(time.Duration(version) * time.Second)
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("policy file error: %s", err)
+		}
+	}
+
+	touch("rules:\n  - name: deny-all\n    condition: \"true\"\n")
+	waitDenial("deny-all")
+
+	// invalid file keeps previous rules
+	touch("rules:\n  - name: invalid\n    condition: route\n")
+	time.Sleep(50 * time.Millisecond)
+	waitDenial("deny-all")
+
+	touch("rules: []\n")
+	waitDenial("")
+}
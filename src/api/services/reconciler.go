@@ -0,0 +1,297 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	ory "github.com/ory/kratos-client-go"
+	"github.com/sirupsen/logrus"
+	"github.com/tomnomnom/linkheader"
+	"os"
+	"sync"
+	"time"
+)
+
+// identitySnapshot maps identity id to fingerprint of its user data.
+type identitySnapshot map[string]string
+
+func userFingerprint(user *api.UserResponse) string {
+	content, _ := json.Marshal(user)
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+// ReconcilerService detects identity changes made directly in Kratos, e.g.
+// by self-service flows. It periodically lists all identities, compares
+// them with the previous snapshot and publishes the same events as user
+// mutations of this service. Snapshot keeps only fingerprints of users
+// and is persisted, so restart does not produce events for known users.
+// Events published by this service update snapshot too, so they are not
+// repeated by reconciler. Such changes are saved after snapshotSaveDelay,
+// on the next reconciliation or on shutdown, whichever comes first.
+type ReconcilerService struct {
+	ReconcilerConfig *base.ReconcilerConfig
+	KratosClient     *ory.APIClient
+	Events           *EventDispatcher
+	History          BaseHistoryService
+	mutex            sync.Mutex
+	snapshot         identitySnapshot
+	// Users changed by service events during listing, their listed data
+	// may be outdated
+	touched map[string]bool
+	// Snapshot is changed by service events and not saved yet
+	dirty bool
+}
+
+// snapshotSaveDelay groups saving of snapshot changed by service events.
+const snapshotSaveDelay = time.Second
+
+func NewReconcilerService(
+	config *base.ReconcilerConfig,
+	client *ory.APIClient,
+	events *EventDispatcher,
+) (*ReconcilerService, error) {
+	service := &ReconcilerService{
+		ReconcilerConfig: config,
+		KratosClient:     client,
+		Events:           events,
+	}
+	if err := service.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+func (service *ReconcilerService) loadSnapshot() error {
+	file := service.ReconcilerConfig.SnapshotFile
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf(
+			"identities snapshot file '%s' open error. %s", file, err.Error(),
+		)
+	}
+	if err = json.Unmarshal(content, &service.snapshot); err != nil {
+		return fmt.Errorf(
+			"identities snapshot file '%s' reading error, invalid format. %s",
+			file,
+			err.Error(),
+		)
+	}
+	return nil
+}
+
+func (service *ReconcilerService) saveSnapshot() error {
+	file := service.ReconcilerConfig.SnapshotFile
+	content, err := json.Marshal(service.snapshot)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(file+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// saveChanges saves snapshot changed by service events.
+func (service *ReconcilerService) saveChanges() {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if !service.dirty {
+		return
+	}
+	service.dirty = false
+	if err := service.saveSnapshot(); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Identities snapshot saving error")
+	}
+}
+
+func (service *ReconcilerService) HandleEvent(event *api.UserEvent) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if service.snapshot == nil {
+		return
+	}
+	if service.touched != nil {
+		service.touched[event.UserId] = true
+	}
+	switch {
+	case event.Type == base.UserDeletedEvent:
+		delete(service.snapshot, event.UserId)
+	case event.User != nil:
+		service.snapshot[event.UserId] = userFingerprint(event.User)
+	default:
+		return
+	}
+	if !service.dirty {
+		service.dirty = true
+		time.AfterFunc(snapshotSaveDelay, service.saveChanges)
+	}
+}
+
+// listUsers returns all users page by page. Any request error fails the
+// whole listing, so missing users are not treated as deleted. Identities
+// with invalid traits are logged and returned as nil users, so they are
+// skipped, but not treated as deleted too.
+func (service *ReconcilerService) listUsers(ctx context.Context) (
+	map[string]*api.UserResponse, error,
+) {
+	users := map[string]*api.UserResponse{}
+	pageToken := ""
+	for {
+		request := service.KratosClient.IdentityAPI.ListIdentities(ctx).
+			PageSize(service.ReconcilerConfig.PageSize)
+		if pageToken != "" {
+			request = request.PageToken(pageToken)
+		}
+		identities, response, err := request.Execute()
+		if err != nil {
+			return nil, err
+		}
+		for i := range identities {
+			user := kratosIdentityToUser(&identities[i])
+			if user == nil {
+				base.Logger.WithFields(logrus.Fields{
+					"user_id": identities[i].Id,
+				}).Warn("Identity with invalid traits skipped by reconciliation")
+			}
+			users[identities[i].Id] = user
+		}
+
+		pageToken = ""
+		for _, link := range linkheader.Parse(
+			response.Header.Get(base.PaginationHeader),
+		) {
+			if link.Rel == "next" {
+				if token := getPageTokenFromUrl(link.URL); token != nil {
+					pageToken = *token
+				}
+			}
+		}
+		if pageToken == "" || len(identities) == 0 {
+			return users, nil
+		}
+	}
+}
+
+type identityChange struct {
+	eventType string
+	user      *api.UserResponse
+}
+
+// applyUsers updates snapshot by current users and returns changes by
+// user id. The first run without persisted snapshot only records it.
+func (service *ReconcilerService) applyUsers(
+	users map[string]*api.UserResponse,
+) (map[string]identityChange, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	touched := service.touched
+	service.touched = nil
+	if service.snapshot == nil {
+		service.snapshot = identitySnapshot{}
+		for id, user := range users {
+			if user != nil {
+				service.snapshot[id] = userFingerprint(user)
+			}
+		}
+		base.Logger.WithFields(logrus.Fields{
+			"users": len(service.snapshot),
+		}).Info("Identities snapshot created")
+		return nil, service.saveSnapshot()
+	}
+
+	changes := map[string]identityChange{}
+	for id, user := range users {
+		if touched[id] || user == nil {
+			continue
+		}
+		fingerprint := userFingerprint(user)
+		previous, known := service.snapshot[id]
+		switch {
+		case !known:
+			changes[id] = identityChange{base.UserCreatedEvent, user}
+		case previous != fingerprint && user.State == base.StateInactive:
+			changes[id] = identityChange{base.UserDeactivatedEvent, user}
+		case previous != fingerprint:
+			changes[id] = identityChange{base.UserUpdatedEvent, user}
+		}
+		service.snapshot[id] = fingerprint
+	}
+	for id := range service.snapshot {
+		if _, exists := users[id]; !exists && !touched[id] {
+			changes[id] = identityChange{base.UserDeletedEvent, nil}
+			delete(service.snapshot, id)
+		}
+	}
+	if len(changes) == 0 && !service.dirty {
+		return nil, nil
+	}
+	service.dirty = false
+	return changes, service.saveSnapshot()
+}
+
+// Reconcile compares current identities with snapshot and publishes
+// events for differences.
+func (service *ReconcilerService) Reconcile(ctx context.Context) error {
+	service.mutex.Lock()
+	service.touched = map[string]bool{}
+	service.mutex.Unlock()
+
+	users, err := service.listUsers(ctx)
+	if err != nil {
+		return err
+	}
+	changes, err := service.applyUsers(users)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+
+	base.Logger.WithFields(logrus.Fields{
+		"changes": len(changes),
+	}).Info("Identity changes made outside of service detected")
+	for id, change := range changes {
+		service.Events.Publish(change.eventType, id, change.user)
+		if service.History == nil || change.user == nil {
+			continue
+		}
+		err = service.History.Record(id, "", base.ReconcilerHistorySource)
+		if err != nil {
+			base.Logger.WithFields(logrus.Fields{
+				"user_id": id,
+				"error":   err.Error(),
+			}).Error("User history recording error")
+		}
+	}
+	return nil
+}
+
+// Run reconciles identities every interval until context is canceled.
+func (service *ReconcilerService) Run(ctx context.Context) {
+	ticker := time.NewTicker(service.ReconcilerConfig.Interval)
+	defer ticker.Stop()
+	for {
+		if err := service.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			base.Logger.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Warn("Identities reconciliation error")
+		}
+		select {
+		case <-ctx.Done():
+			service.saveChanges()
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"encoding/json"
+	ory "github.com/ory/kratos-client-go"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// recordingSubscriber keeps types of published events by user id.
+type recordingSubscriber struct {
+	events map[string]string
+}
+
+func (subscriber *recordingSubscriber) HandleEvent(event *api.UserEvent) {
+	subscriber.events[event.UserId] = event.Type
+}
+
+func (service *ReconcilerService) snapshotSize() int {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	return len(service.snapshot)
+}
+
+func testIdentity(id string, traits any) map[string]any {
+	return map[string]any{
+		"id":         id,
+		"schema_id":  "default",
+		"schema_url": "",
+		"state":      base.StateActive,
+		"traits":     traits,
+	}
+}
+
+func testTraits(username string) map[string]any {
+	return map[string]any{
+		string(base.Username):  username,
+		string(base.Email):     username + "@example.com",
+		string(base.FirstName): "John",
+		string(base.LastName):  "Doe",
+	}
+}
+
+func TestReconcileSkipsInvalidIdentities(t *testing.T) {
+	identities := []map[string]any{
+		testIdentity("1", testTraits("john")),
+		testIdentity("2", testTraits("jane")),
+	}
+	kratos := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(writer).Encode(identities)
+		},
+	))
+	defer kratos.Close()
+
+	configuration := ory.NewConfiguration()
+	configuration.Servers = ory.ServerConfigurations{{URL: kratos.URL}}
+	subscriber := &recordingSubscriber{events: map[string]string{}}
+	events := &EventDispatcher{}
+	events.Subscribe(subscriber)
+	service, err := NewReconcilerService(
+		&base.ReconcilerConfig{
+			Interval:     time.Minute,
+			PageSize:     10,
+			SnapshotFile: filepath.Join(t.TempDir(), "snapshot.json"),
+		},
+		ory.NewAPIClient(configuration),
+		events,
+	)
+	if err != nil {
+		t.Fatalf("reconciler error: %s", err)
+	}
+	if err = service.Reconcile(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// identity 2 becomes invalid, identity 3 is created
+	identities[1] = testIdentity("2", "invalid")
+	identities = append(identities, testIdentity("3", testTraits("jim")))
+	if err = service.Reconcile(context.Background()); err != nil {
+		t.Fatalf("invalid identity fails reconciliation: %s", err)
+	}
+	expected := map[string]string{"3": base.UserCreatedEvent}
+	if len(subscriber.events) != len(expected) ||
+		subscriber.events["3"] != expected["3"] {
+		t.Errorf("expected events %v, got %v", expected, subscriber.events)
+	}
+	if _, ok := service.snapshot["2"]; !ok {
+		t.Error("invalid identity is removed from snapshot")
+	}
+}
+
+func TestReconcileKeepsOwnEventsAfterRestart(t *testing.T) {
+	identities := []map[string]any{testIdentity("1", testTraits("john"))}
+	kratos := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(writer).Encode(identities)
+		},
+	))
+	defer kratos.Close()
+
+	configuration := ory.NewConfiguration()
+	configuration.Servers = ory.ServerConfigurations{{URL: kratos.URL}}
+	config := &base.ReconcilerConfig{
+		Interval:     time.Hour,
+		PageSize:     10,
+		SnapshotFile: filepath.Join(t.TempDir(), "snapshot.json"),
+	}
+	subscriber := &recordingSubscriber{events: map[string]string{}}
+	events := &EventDispatcher{}
+	events.Subscribe(subscriber)
+	start := func() *ReconcilerService {
+		service, err := NewReconcilerService(
+			config, ory.NewAPIClient(configuration), events,
+		)
+		if err != nil {
+			t.Fatalf("reconciler error: %s", err)
+		}
+		return service
+	}
+
+	service := start()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		service.Run(ctx)
+		close(stopped)
+	}()
+	// the first reconciliation creates snapshot
+	for service.snapshotSize() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// user is created by this service
+	identities = append(identities, testIdentity("2", testTraits("jim")))
+	service.HandleEvent(&api.UserEvent{
+		Type:   base.UserCreatedEvent,
+		UserId: "2",
+		User: &api.UserResponse{
+			Id:        "2",
+			Username:  "jim",
+			Email:     "jim@example.com",
+			FirstName: "John",
+			LastName:  "Doe",
+			State:     base.StateActive,
+		},
+	})
+	cancel()
+	<-stopped
+
+	if err := start().Reconcile(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(subscriber.events) != 0 {
+		t.Errorf("expected no events after restart, got %v", subscriber.events)
+	}
+}
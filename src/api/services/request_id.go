@@ -0,0 +1,31 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"net/http"
+)
+
+// RequestIdTransport forwards id of API request, which caused outgoing
+// call, in X-Request-ID header.
+type RequestIdTransport struct {
+	Next http.RoundTripper
+}
+
+func (transport *RequestIdTransport) RoundTrip(
+	request *http.Request,
+) (*http.Response, error) {
+	next := transport.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	requestId := api.RequestIdFromContext(request.Context())
+	if requestId == "" || request.Header.Get(base.RequestIdHeader) != "" {
+		return next.RoundTrip(request)
+	}
+	// RoundTripper must not modify request
+	forwarded := request.Clone(request.Context())
+	forwarded.Header.Set(base.RequestIdHeader, requestId)
+	return next.RoundTrip(forwarded)
+}
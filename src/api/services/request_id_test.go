@@ -0,0 +1,63 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIdTransport(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			received <- request.Header.Get(base.RequestIdHeader)
+		},
+	))
+	defer server.Close()
+	client := &http.Client{Transport: &RequestIdTransport{}}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		header    string
+		forwarded string
+	}{
+		{name: "without request id", ctx: context.Background()},
+		{
+			name:      "request id of context",
+			ctx:       api.ContextWithRequestId(context.Background(), "9f2c51e0a4b8d3c7"),
+			forwarded: "9f2c51e0a4b8d3c7",
+		},
+		{
+			name:      "request id set by caller",
+			ctx:       api.ContextWithRequestId(context.Background(), "9f2c51e0a4b8d3c7"),
+			header:    "ticket-42",
+			forwarded: "ticket-42",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, _ := http.NewRequestWithContext(
+				test.ctx, http.MethodGet, server.URL, nil,
+			)
+			if test.header != "" {
+				request.Header.Set(base.RequestIdHeader, test.header)
+			}
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			response.Body.Close()
+
+			if forwarded := <-received; forwarded != test.forwarded {
+				t.Errorf("expected request id %q, got %q", test.forwarded, forwarded)
+			}
+			if request.Header.Get(base.RequestIdHeader) != test.header {
+				t.Error("original request is modified")
+			}
+		})
+	}
+}
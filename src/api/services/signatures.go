@@ -0,0 +1,143 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"access-backend/signing"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type BaseSignatureService interface {
+	VerifyRequest(request *http.Request) (*api.AdminUser, error)
+}
+
+// NonceCache remembers nonces of accepted signed requests until they can
+// not pass clock skew check anymore.
+type NonceCache struct {
+	mutex     sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewNonceCache() *NonceCache {
+	return &NonceCache{nonces: map[string]time.Time{}}
+}
+
+// Add stores nonce and returns false if it was already used.
+func (cache *NonceCache) Add(nonce string, ttl time.Duration) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(cache.lastSweep) >= time.Minute {
+		for key, expiresAt := range cache.nonces {
+			if now.After(expiresAt) {
+				delete(cache.nonces, key)
+			}
+		}
+		cache.lastSweep = now
+	}
+
+	if expiresAt, ok := cache.nonces[nonce]; ok && now.Before(expiresAt) {
+		return false
+	}
+	cache.nonces[nonce] = now.Add(ttl)
+	return true
+}
+
+type SignatureService struct {
+	BaseSignatureService
+	AuthConfig *base.AuthorizationConfig
+	Nonces     *NonceCache
+}
+
+func newSignatureError(summary string) base.ServiceError {
+	return base.ServiceError{
+		Summary: summary,
+		Status:  http.StatusForbidden,
+	}
+}
+
+func (service *SignatureService) findKey(keyId string) *base.SigningKeyConfig {
+	for i := range service.AuthConfig.SigningKeys {
+		if service.AuthConfig.SigningKeys[i].Id == keyId {
+			return &service.AuthConfig.SigningKeys[i]
+		}
+	}
+	return nil
+}
+
+func (service *SignatureService) checkTimestamp(value string) error {
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return newSignatureError(
+			"Invalid '" + signing.TimestampHeader + "' header",
+		)
+	}
+	skew := time.Since(time.Unix(timestamp, 0)).Abs()
+	if skew > service.AuthConfig.MaxClockSkew {
+		return newSignatureError("Request timestamp is out of allowed range")
+	}
+	return nil
+}
+
+func (service *SignatureService) VerifyRequest(request *http.Request) (
+	*api.AdminUser, error,
+) {
+	keyId, signature, err := signing.ParseAuthorization(
+		request.Header.Get("Authorization"),
+	)
+	if err != nil {
+		return nil, newSignatureError("Invalid signature format")
+	}
+	key := service.findKey(keyId)
+	if key == nil {
+		return nil, newSignatureError("Invalid signature")
+	}
+	if err = service.checkTimestamp(
+		request.Header.Get(signing.TimestampHeader),
+	); err != nil {
+		return nil, err
+	}
+	nonce := request.Header.Get(signing.NonceHeader)
+	if nonce == "" {
+		return nil, newSignatureError(
+			"Header '" + signing.NonceHeader + "' required",
+		)
+	}
+
+	if request.Body != nil {
+		request.Body = http.MaxBytesReader(
+			nil, request.Body, service.AuthConfig.MaxSignedBodySize,
+		)
+	}
+	stringToSign, err := signing.RequestStringToSign(request)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, base.ServiceError{
+				Summary: fmt.Sprintf(
+					"Signed request body can not exceed %d bytes",
+					maxBytesError.Limit,
+				),
+				Status: http.StatusRequestEntityTooLarge,
+			}
+		}
+		return nil, err
+	}
+	expected := signing.ComputeSignature(key.Secret, stringToSign)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, newSignatureError("Invalid signature")
+	}
+	if !service.Nonces.Add(keyId+":"+nonce, 2*service.AuthConfig.MaxClockSkew) {
+		return nil, newSignatureError("Request nonce already used")
+	}
+
+	return newAdminUser(service.AuthConfig, key.Id, key.Role), nil
+}
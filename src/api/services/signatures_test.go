@@ -0,0 +1,199 @@
+package services
+
+import (
+	"access-backend/base"
+	"access-backend/signing"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "Hs72jKsm2Ldk8Qp1Zmx7Vb3Nc5Rt9Wy0"
+
+func newTestSignatureService() *SignatureService {
+	return &SignatureService{
+		AuthConfig: &base.AuthorizationConfig{
+			Roles: map[string][]base.Permission{
+				base.OperatorRole: {base.ReadUsersPermission},
+			},
+			SigningKeys: []base.SigningKeyConfig{{
+				Id:     "ci",
+				Secret: testSigningSecret,
+				Role:   base.OperatorRole,
+			}},
+			MaxClockSkew:      5 * time.Minute,
+			MaxSignedBodySize: 64,
+		},
+		Nonces: NewNonceCache(),
+	}
+}
+
+func newSignedRequest(t *testing.T, body string) *http.Request {
+	request := httptest.NewRequest(
+		http.MethodPost, "/backend/v1/users?limit=5", strings.NewReader(body),
+	)
+	if err := signing.SignRequest(request, "ci", testSigningSecret); err != nil {
+		t.Fatalf("signing error: %s", err)
+	}
+	return request
+}
+
+// resign replaces signature after headers are modified.
+func resign(t *testing.T, request *http.Request, secret string) {
+	stringToSign, err := signing.RequestStringToSign(request)
+	if err != nil {
+		t.Fatalf("signing error: %s", err)
+	}
+	request.Header.Set("Authorization", signing.FormatAuthorization(
+		"ci", signing.ComputeSignature(secret, stringToSign),
+	))
+}
+
+func TestVerifyRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		modify func(t *testing.T, request *http.Request)
+		status int
+	}{
+		{
+			name: "valid",
+			body: `{"username":"john"}`,
+		},
+		{
+			name: "missing authorization",
+			modify: func(t *testing.T, request *http.Request) {
+				request.Header.Del("Authorization")
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "malformed authorization",
+			modify: func(t *testing.T, request *http.Request) {
+				request.Header.Set("Authorization", signing.Scheme+" keyId=ci")
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "unknown key",
+			modify: func(t *testing.T, request *http.Request) {
+				request.Header.Set(
+					"Authorization", signing.FormatAuthorization("other", "abc"),
+				)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "wrong secret",
+			modify: func(t *testing.T, request *http.Request) {
+				resign(t, request, strings.Repeat("x", 32))
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "modified body",
+			body: `{"username":"john"}`,
+			modify: func(t *testing.T, request *http.Request) {
+				request.Body = http.NoBody
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "modified query",
+			modify: func(t *testing.T, request *http.Request) {
+				request.URL.RawQuery = "limit=500"
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "missing timestamp",
+			modify: func(t *testing.T, request *http.Request) {
+				request.Header.Del(signing.TimestampHeader)
+				resign(t, request, testSigningSecret)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "expired timestamp",
+			modify: func(t *testing.T, request *http.Request) {
+				request.Header.Set(signing.TimestampHeader, strconv.FormatInt(
+					time.Now().Add(-time.Hour).Unix(), 10,
+				))
+				resign(t, request, testSigningSecret)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "timestamp in future",
+			modify: func(t *testing.T, request *http.Request) {
+				request.Header.Set(signing.TimestampHeader, strconv.FormatInt(
+					time.Now().Add(time.Hour).Unix(), 10,
+				))
+				resign(t, request, testSigningSecret)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "missing nonce",
+			modify: func(t *testing.T, request *http.Request) {
+				request.Header.Del(signing.NonceHeader)
+				resign(t, request, testSigningSecret)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "body too large",
+			body:   strings.Repeat("x", 65),
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := newTestSignatureService()
+			request := newSignedRequest(t, test.body)
+			if test.modify != nil {
+				test.modify(t, request)
+			}
+
+			user, err := service.VerifyRequest(request)
+			if test.status == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if user.Username != "ci" || user.Role != base.OperatorRole {
+					t.Errorf("unexpected user %+v", user)
+				}
+				return
+			}
+			var serviceError base.ServiceError
+			if !errors.As(err, &serviceError) {
+				t.Fatalf("expected service error, got %v", err)
+			}
+			if serviceError.Status != test.status {
+				t.Errorf(
+					"expected status %d, got %d (%s)",
+					test.status, serviceError.Status, serviceError.Summary,
+				)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestReplay(t *testing.T) {
+	service := newTestSignatureService()
+	request := newSignedRequest(t, "")
+	if _, err := service.VerifyRequest(request); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	replayed := newSignedRequest(t, "")
+	replayed.Header = request.Header.Clone()
+	if _, err := service.VerifyRequest(replayed); err == nil {
+		t.Error("replayed request is accepted")
+	}
+}
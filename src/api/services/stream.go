@@ -0,0 +1,139 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamEvent is user event with stream id. Id consists of stream start
+// time and event sequence number, so ids of previous service runs are
+// recognized after restart. Reset event has no user event, it tells
+// client that events after its last event id are lost.
+type StreamEvent struct {
+	Id       string
+	Sequence int64
+	Event    *api.UserEvent
+	Reset    bool
+}
+
+type BaseEventStreamService interface {
+	Subscribe(lastEventId string) (
+		backlog []*StreamEvent, events <-chan *StreamEvent, unsubscribe func(),
+	)
+}
+
+// EventStreamService keeps the latest user events in a bounded ring buffer
+// and broadcasts new events to connected stream clients. Clients which
+// can not keep up are disconnected and can resume by the last event id.
+// If events after the last event id are not buffered, e.g. id belongs to
+// previous service run, client gets reset event and new events only.
+type EventStreamService struct {
+	BaseEventStreamService
+	StreamConfig *base.EventStreamConfig
+	mutex        sync.Mutex
+	epoch        string
+	buffer       []*StreamEvent
+	sequence     int64
+	clients      map[chan *StreamEvent]struct{}
+}
+
+func NewEventStreamService(config *base.EventStreamConfig) *EventStreamService {
+	return &EventStreamService{
+		StreamConfig: config,
+		epoch:        strconv.FormatInt(time.Now().UnixMilli(), 10),
+		buffer:       make([]*StreamEvent, config.BufferSize),
+		clients:      map[chan *StreamEvent]struct{}{},
+	}
+}
+
+func (service *EventStreamService) streamId(sequence int64) string {
+	return service.epoch + "-" + strconv.FormatInt(sequence, 10)
+}
+
+func (service *EventStreamService) HandleEvent(event *api.UserEvent) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.sequence++
+	streamEvent := &StreamEvent{
+		Id:       service.streamId(service.sequence),
+		Sequence: service.sequence,
+		Event:    event,
+	}
+	service.buffer[service.sequence%int64(len(service.buffer))] = streamEvent
+
+	for client := range service.clients {
+		select {
+		case client <- streamEvent:
+		default:
+			delete(service.clients, client)
+			close(client)
+		}
+	}
+}
+
+// parseLastEventId returns sequence of the last received event. It returns
+// false if id belongs to another stream run or is not valid.
+func (service *EventStreamService) parseLastEventId(
+	lastEventId string,
+) (int64, bool) {
+	epoch, sequence, found := strings.Cut(lastEventId, "-")
+	if !found || epoch != service.epoch {
+		return 0, false
+	}
+	parsed, err := strconv.ParseInt(sequence, 10, 64)
+	if err != nil || parsed < 0 || parsed > service.sequence {
+		return 0, false
+	}
+	return parsed, true
+}
+
+func (service *EventStreamService) Subscribe(lastEventId string) (
+	[]*StreamEvent, <-chan *StreamEvent, func(),
+) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	var backlog []*StreamEvent
+	if lastEventId != "" {
+		last, ok := service.parseLastEventId(lastEventId)
+		if !ok || last < service.sequence-int64(len(service.buffer)) {
+			// reset event id allows to resume from now on reconnect
+			backlog = append(backlog, &StreamEvent{
+				Id:       service.streamId(service.sequence),
+				Sequence: service.sequence,
+				Reset:    true,
+			})
+			last = service.sequence
+		}
+		for sequence := last + 1; sequence <= service.sequence; sequence++ {
+			backlog = append(
+				backlog, service.buffer[sequence%int64(len(service.buffer))],
+			)
+		}
+	}
+
+	client := make(chan *StreamEvent, service.StreamConfig.ClientBufferSize)
+	service.clients[client] = struct{}{}
+	unsubscribe := func() {
+		service.mutex.Lock()
+		defer service.mutex.Unlock()
+		if _, ok := service.clients[client]; ok {
+			delete(service.clients, client)
+			close(client)
+		}
+	}
+	return backlog, client, unsubscribe
+}
+
+// ClientsCount returns number of connected stream clients.
+func (service *EventStreamService) ClientsCount() int {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	return len(service.clients)
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"strconv"
+	"testing"
+)
+
+func newTestStreamService(bufferSize int) *EventStreamService {
+	return NewEventStreamService(&base.EventStreamConfig{
+		BufferSize:       bufferSize,
+		ClientBufferSize: 2,
+	})
+}
+
+func publishStreamEvents(service *EventStreamService, count int) {
+	for i := 0; i < count; i++ {
+		service.HandleEvent(&api.UserEvent{
+			Type:   base.UserUpdatedEvent,
+			UserId: strconv.Itoa(i),
+		})
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	service := newTestStreamService(10)
+	publishStreamEvents(service, 5)
+
+	tests := []struct {
+		name        string
+		lastEventId string
+		reset       bool
+		sequences   []int64
+	}{
+		{name: "new client"},
+		{
+			name:        "buffered events",
+			lastEventId: service.streamId(3),
+			sequences:   []int64{4, 5},
+		},
+		{name: "up to date", lastEventId: service.streamId(5)},
+		{
+			name:        "previous run",
+			lastEventId: "1700000000000-3",
+			reset:       true,
+		},
+		{name: "invalid id", lastEventId: "invalid", reset: true},
+		{
+			name:        "id ahead of stream",
+			lastEventId: service.streamId(8),
+			reset:       true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backlog, _, unsubscribe := service.Subscribe(test.lastEventId)
+			defer unsubscribe()
+
+			if test.reset {
+				if len(backlog) == 0 || !backlog[0].Reset {
+					t.Fatalf("expected reset event, got %v", backlog)
+				}
+				if backlog[0].Id != service.streamId(5) {
+					t.Errorf("expected reset id of the last event, got %s", backlog[0].Id)
+				}
+				backlog = backlog[1:]
+			}
+			var sequences []int64
+			for _, event := range backlog {
+				if event.Reset {
+					t.Fatalf("unexpected reset event")
+				}
+				sequences = append(sequences, event.Sequence)
+			}
+			if len(sequences) != len(test.sequences) {
+				t.Fatalf("expected events %v, got %v", test.sequences, sequences)
+			}
+			for i := range sequences {
+				if sequences[i] != test.sequences[i] {
+					t.Fatalf("expected events %v, got %v", test.sequences, sequences)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamResetAfterOverflow(t *testing.T) {
+	service := newTestStreamService(3)
+	publishStreamEvents(service, 6)
+
+	// events 4-6 are buffered, so client after event 3 misses nothing
+	backlog, _, unsubscribe := service.Subscribe(service.streamId(3))
+	unsubscribe()
+	if len(backlog) != 3 || backlog[0].Reset || backlog[0].Sequence != 4 {
+		t.Errorf("expected buffered events 4-6, got %v", backlog)
+	}
+
+	backlog, _, unsubscribe = service.Subscribe(service.streamId(2))
+	unsubscribe()
+	if len(backlog) != 1 || !backlog[0].Reset {
+		t.Errorf("expected reset event only, got %v", backlog)
+	}
+}
+
+func TestStreamResetIdResumes(t *testing.T) {
+	service := newTestStreamService(10)
+	backlog, _, unsubscribe := service.Subscribe("1700000000000-3")
+	unsubscribe()
+	if len(backlog) != 1 || !backlog[0].Reset {
+		t.Fatalf("expected reset event, got %v", backlog)
+	}
+
+	publishStreamEvents(service, 2)
+	backlog, _, unsubscribe = service.Subscribe(backlog[0].Id)
+	unsubscribe()
+	if len(backlog) != 2 || backlog[0].Reset || backlog[0].Sequence != 1 {
+		t.Errorf("expected events after reset, got %v", backlog)
+	}
+}
+
+func TestStreamDisconnectsSlowClient(t *testing.T) {
+	service := newTestStreamService(10)
+	_, events, unsubscribe := service.Subscribe("")
+	defer unsubscribe()
+
+	publishStreamEvents(service, 3)
+	received := 0
+	for range events {
+		received++
+	}
+	if received != 2 || service.ClientsCount() != 0 {
+		t.Errorf(
+			"expected slow client disconnected after 2 events, got %d events, %d clients",
+			received,
+			service.ClientsCount(),
+		)
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExchangeTokenPrefix distinguishes exchanged tokens from static ones.
+const ExchangeTokenPrefix string = "sat."
+
+type tokenClaims struct {
+	Id        string            `json:"jti"`
+	Subject   string            `json:"sub"`
+	Role      string            `json:"role"`
+	Scopes    []base.Permission `json:"scopes"`
+	UserIds   []string          `json:"user_ids,omitempty"`
+	IssuedAt  int64             `json:"iat"`
+	ExpiresAt int64             `json:"exp"`
+}
+
+type BaseTokenService interface {
+	IssueToken(caller *api.AdminUser, request *api.TokenRequest) (
+		*api.TokenResponse, error,
+	)
+	ParseToken(token string) (*api.AdminUser, error)
+	TokenId(token string) string
+	RevokeToken(tokenId string) error
+}
+
+// RevocationList keeps ids of revoked tokens until they expire. List is
+// saved to file, if it is set, so revocations survive restarts.
+type RevocationList struct {
+	mutex   sync.RWMutex
+	File    string
+	revoked map[string]time.Time
+}
+
+func NewRevocationList(file string) (*RevocationList, error) {
+	list := &RevocationList{File: file, revoked: map[string]time.Time{}}
+	if file == "" {
+		return list, nil
+	}
+
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return list, nil
+	} else if err != nil {
+		return nil, fmt.Errorf(
+			"revocation file '%s' open error. %s", file, err.Error(),
+		)
+	}
+	if err = json.Unmarshal(content, &list.revoked); err != nil {
+		return nil, fmt.Errorf(
+			"revocation file '%s' reading error, invalid format. %s",
+			file,
+			err.Error(),
+		)
+	}
+	return list, nil
+}
+
+func (list *RevocationList) IsRevoked(tokenId string) bool {
+	list.mutex.RLock()
+	defer list.mutex.RUnlock()
+
+	_, ok := list.revoked[tokenId]
+	return ok
+}
+
+func (list *RevocationList) Revoke(tokenId string, expiresAt time.Time) error {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+
+	now := time.Now()
+	for id, expiration := range list.revoked {
+		if now.After(expiration) {
+			delete(list.revoked, id)
+		}
+	}
+	list.revoked[tokenId] = expiresAt
+	if list.File == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(list.revoked)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(list.File, content, 0600)
+}
+
+type TokenService struct {
+	BaseTokenService
+	ExchangeConfig *base.TokenExchangeConfig
+	Revocations    *RevocationList
+}
+
+func newTokenId() (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (service *TokenService) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(service.ExchangeConfig.Secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (service *TokenService) IssueToken(
+	caller *api.AdminUser, request *api.TokenRequest,
+) (*api.TokenResponse, error) {
+	if caller.TokenId != "" {
+		return nil, base.ServiceError{
+			Summary: "Exchanged token can not be used to issue tokens",
+			Status:  http.StatusForbidden,
+		}
+	}
+	for _, scope := range request.Scopes {
+		if !caller.HasPermission(scope) {
+			return nil, base.ServiceError{
+				Summary: fmt.Sprintf("Scope '%s' is not granted to caller", scope),
+				Status:  http.StatusForbidden,
+			}
+		}
+	}
+
+	ttl := service.ExchangeConfig.DefaultTtl
+	if request.Ttl > 0 {
+		ttl = time.Duration(request.Ttl) * time.Second
+	}
+	if ttl > service.ExchangeConfig.MaxTtl {
+		return nil, base.ServiceError{
+			Summary: fmt.Sprintf(
+				"Token TTL can not exceed %d seconds",
+				int64(service.ExchangeConfig.MaxTtl.Seconds()),
+			),
+			Status: http.StatusUnprocessableEntity,
+		}
+	}
+
+	tokenId, err := newTokenId()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	claims := tokenClaims{
+		Id:        tokenId,
+		Subject:   caller.Username,
+		Role:      caller.Role,
+		Scopes:    slices.Compact(slices.Clone(request.Scopes)),
+		UserIds:   request.UserIds,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+	content, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(content)
+
+	base.Logger.WithFields(logrus.Fields{
+		"token_id": tokenId,
+		"subject":  caller.Username,
+		"scopes":   claims.Scopes,
+		"user_ids": claims.UserIds,
+		"ttl":      ttl.String(),
+	}).Info("Access token issued")
+
+	return &api.TokenResponse{
+		Token:     ExchangeTokenPrefix + payload + "." + service.sign(payload),
+		TokenId:   tokenId,
+		Scopes:    claims.Scopes,
+		UserIds:   claims.UserIds,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	}, nil
+}
+
+// parseClaims checks token signature and returns its claims, which are
+// not checked for expiration and revocation.
+func (service *TokenService) parseClaims(token string) (*tokenClaims, error) {
+	invalidToken := base.ServiceError{
+		Summary: "Invalid token",
+		Status:  http.StatusForbidden,
+	}
+
+	payload, signature, found := strings.Cut(
+		strings.TrimPrefix(token, ExchangeTokenPrefix), ".",
+	)
+	if !found || !hmac.Equal([]byte(signature), []byte(service.sign(payload))) {
+		return nil, invalidToken
+	}
+	content, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, invalidToken
+	}
+	var claims tokenClaims
+	if err = json.Unmarshal(content, &claims); err != nil || claims.Id == "" {
+		return nil, invalidToken
+	}
+	return &claims, nil
+}
+
+// TokenId returns id of token with valid signature, even if it is expired
+// or revoked, or empty string otherwise.
+func (service *TokenService) TokenId(token string) string {
+	claims, err := service.parseClaims(token)
+	if err != nil {
+		return ""
+	}
+	return claims.Id
+}
+
+func (service *TokenService) ParseToken(token string) (*api.AdminUser, error) {
+	claims, err := service.parseClaims(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, base.ServiceError{
+			Summary: "Token expired",
+			Status:  http.StatusForbidden,
+		}
+	}
+	if service.Revocations.IsRevoked(claims.Id) {
+		return nil, base.ServiceError{
+			Summary: "Token revoked",
+			Status:  http.StatusForbidden,
+		}
+	}
+
+	return &api.AdminUser{
+		Username:    claims.Subject,
+		Role:        claims.Role,
+		Permissions: claims.Scopes,
+		TokenId:     claims.Id,
+		UserIds:     claims.UserIds,
+	}, nil
+}
+
+func (service *TokenService) RevokeToken(tokenId string) error {
+	err := service.Revocations.Revoke(
+		tokenId, time.Now().Add(service.ExchangeConfig.MaxTtl),
+	)
+	if err != nil {
+		return err
+	}
+
+	base.Logger.WithFields(logrus.Fields{
+		"token_id": tokenId,
+	}).Info("Access token revoked")
+	return nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestTokenService() *TokenService {
+	revocations, _ := NewRevocationList("")
+	return &TokenService{
+		ExchangeConfig: &base.TokenExchangeConfig{
+			Enabled:    true,
+			Secret:     "Qm8sLw3Kd9Zx2Vb7Nc4Rt6Yh1Jp5Gf0Ae",
+			DefaultTtl: 15 * time.Minute,
+			MaxTtl:     time.Hour,
+		},
+		Revocations: revocations,
+	}
+}
+
+func issueTestToken(t *testing.T, service *TokenService) *api.TokenResponse {
+	response, err := service.IssueToken(
+		&api.AdminUser{
+			Username:    "ci",
+			Role:        base.OperatorRole,
+			Permissions: []base.Permission{base.ReadUsersPermission},
+		},
+		&api.TokenRequest{Scopes: []base.Permission{base.ReadUsersPermission}},
+	)
+	if err != nil {
+		t.Fatalf("issuing error: %v", err)
+	}
+	return response
+}
+
+// signedToken returns token with given claims signed by service.
+func signedToken(t *testing.T, service *TokenService, claims tokenClaims) string {
+	content, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(content)
+	return ExchangeTokenPrefix + payload + "." + service.sign(payload)
+}
+
+func TestParseToken(t *testing.T) {
+	service := newTestTokenService()
+	issued := issueTestToken(t, service)
+	revoked := issueTestToken(t, service)
+	if err := service.RevokeToken(revoked.TokenId); err != nil {
+		t.Fatal(err)
+	}
+	expired := signedToken(t, service, tokenClaims{
+		Id:        "expired",
+		Subject:   "ci",
+		ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+	})
+
+	tests := []struct {
+		name    string
+		token   string
+		tokenId string
+		summary string
+	}{
+		{name: "valid", token: issued.Token, tokenId: issued.TokenId},
+		{
+			name:    "bad signature",
+			token:   issued.Token[:len(issued.Token)-2] + "xx",
+			summary: "Invalid token",
+		},
+		{
+			name:    "missing signature",
+			token:   issued.Token[:strings.LastIndex(issued.Token, ".")],
+			summary: "Invalid token",
+		},
+		{
+			name:    "garbage",
+			token:   ExchangeTokenPrefix + "abc",
+			summary: "Invalid token",
+		},
+		{
+			name:    "expired",
+			token:   expired,
+			tokenId: "expired",
+			summary: "Token expired",
+		},
+		{
+			name:    "revoked",
+			token:   revoked.Token,
+			tokenId: revoked.TokenId,
+			summary: "Token revoked",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user, err := service.ParseToken(test.token)
+			if test.summary == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if user.TokenId != test.tokenId || user.Username != "ci" {
+					t.Errorf("unexpected user %+v", user)
+				}
+			} else {
+				var serviceError base.ServiceError
+				if !errors.As(err, &serviceError) ||
+					serviceError.Summary != test.summary {
+					t.Errorf("expected %q error, got %v", test.summary, err)
+				}
+			}
+			if tokenId := service.TokenId(test.token); tokenId != test.tokenId {
+				t.Errorf("expected token id %q, got %q", test.tokenId, tokenId)
+			}
+		})
+	}
+}
+
+func TestIssueTokenLimits(t *testing.T) {
+	service := newTestTokenService()
+	caller := &api.AdminUser{
+		Username:    "ci",
+		Role:        base.ViewerRole,
+		Permissions: []base.Permission{base.ReadUsersPermission},
+	}
+
+	tests := []struct {
+		name    string
+		caller  *api.AdminUser
+		request api.TokenRequest
+	}{
+		{
+			name:   "scope not granted",
+			caller: caller,
+			request: api.TokenRequest{
+				Scopes: []base.Permission{base.DeleteUsersPermission},
+			},
+		},
+		{
+			name:   "TTL exceeds maximum",
+			caller: caller,
+			request: api.TokenRequest{
+				Scopes: []base.Permission{base.ReadUsersPermission},
+				Ttl:    int64((2 * time.Hour).Seconds()),
+			},
+		},
+		{
+			name: "exchanged token",
+			caller: &api.AdminUser{
+				Username:    "ci",
+				Permissions: caller.Permissions,
+				TokenId:     "abc",
+			},
+			request: api.TokenRequest{
+				Scopes: []base.Permission{base.ReadUsersPermission},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := service.IssueToken(test.caller, &test.request); err == nil {
+				t.Error("token is issued")
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	ory "github.com/ory/kratos-client-go"
 	"github.com/sirupsen/logrus"
 	"github.com/tomnomnom/linkheader"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"net/url"
 )
@@ -29,6 +30,7 @@ func kratosIdentityToUser(identity *ory.Identity) *api.UserResponse {
 		Email:     traits[string(base.Email)].(string),
 		FirstName: traits[string(base.FirstName)].(string),
 		LastName:  traits[string(base.LastName)].(string),
+		State:     identity.GetState(),
 	}
 }
 
@@ -38,12 +40,51 @@ type BaseUserService interface {
 		*api.GetUsersResponse, error,
 	)
 	DeleteUser(userId string) error
+	SetUserState(userId string, state string) (*api.UserResponse, error)
+	GetUser(userId string) (*api.UserResponse, error)
+	RevokeSessions(userId string) error
+	// WithRequestContext returns service, which traces Kratos calls as
+	// children of span in ctx and forwards request id of ctx
+	WithRequestContext(ctx context.Context) BaseUserService
 }
 
 type UserService struct {
 	BaseUserService
 	Context      *context.Context
 	KratosClient *ory.APIClient
+	Events       *EventDispatcher
+}
+
+// requestContext returns service context with span and request id of
+// request context, so calls are traced as children of request span and
+// are not canceled with request. It returns false, if request context has
+// neither of them.
+func requestContext(
+	serviceCtx context.Context, requestCtx context.Context,
+) (context.Context, bool) {
+	span := trace.SpanFromContext(requestCtx)
+	requestId := api.RequestIdFromContext(requestCtx)
+	if !span.SpanContext().IsValid() && requestId == "" {
+		return serviceCtx, false
+	}
+	traced := trace.ContextWithSpan(serviceCtx, span)
+	return api.ContextWithRequestId(traced, requestId), true
+}
+
+// WithRequestContext keeps service context for Kratos calls, so they are
+// not canceled with request, and only takes span and request id from ctx.
+func (service *UserService) WithRequestContext(
+	ctx context.Context,
+) BaseUserService {
+	traced, ok := requestContext(*service.Context, ctx)
+	if !ok {
+		return service
+	}
+	return &UserService{
+		Context:      &traced,
+		KratosClient: service.KratosClient,
+		Events:       service.Events,
+	}
 }
 
 func (service *UserService) AddUser(request *api.AddUserRequest) (
@@ -86,6 +127,7 @@ func (service *UserService) AddUser(request *api.AddUserRequest) (
 
 	result := kratosIdentityToUser(identity)
 	if result != nil {
+		service.Events.Publish(base.UserCreatedEvent, result.Id, result)
 		return result, nil
 	} else {
 		return nil, base.NewKratosError("User data not created", nil)
@@ -171,5 +213,80 @@ func (service *UserService) DeleteUser(userId string) error {
 			)
 		}
 	}
+	service.Events.Publish(base.UserDeletedEvent, userId, nil)
+	return nil
+}
+
+func (service *UserService) SetUserState(userId string, state string) (
+	*api.UserResponse, error,
+) {
+	patch := []ory.JsonPatch{
+		{Op: "replace", Path: "/state", Value: state},
+	}
+	identity, response, err := service.KratosClient.IdentityAPI.PatchIdentity(
+		*service.Context, userId,
+	).JsonPatch(patch).Execute()
+
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil, base.ServiceError{
+				Summary: "User with id '" + userId + "' not found",
+				Status:  http.StatusNotFound,
+			}
+		}
+		return nil, base.NewKratosError("Error updating user state", err)
+	}
+
+	result := kratosIdentityToUser(identity)
+	if result != nil {
+		eventType := base.UserUpdatedEvent
+		if state == base.StateInactive {
+			eventType = base.UserDeactivatedEvent
+		}
+		service.Events.Publish(eventType, userId, result)
+		return result, nil
+	} else {
+		return nil, base.ServiceError{Summary: "User data not updated"}
+	}
+}
+
+func (service *UserService) GetUser(userId string) (*api.UserResponse, error) {
+	identity, response, err := service.KratosClient.IdentityAPI.GetIdentity(
+		*service.Context, userId,
+	).Execute()
+
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil, base.ServiceError{
+				Summary: "User with id '" + userId + "' not found",
+				Status:  http.StatusNotFound,
+			}
+		}
+		return nil, base.NewKratosError("Error retrieving user", err)
+	}
+
+	result := kratosIdentityToUser(identity)
+	if result != nil {
+		return result, nil
+	} else {
+		return nil, base.ServiceError{Summary: "User data not parsed"}
+	}
+}
+
+func (service *UserService) RevokeSessions(userId string) error {
+	response, err := service.KratosClient.IdentityAPI.DeleteIdentitySessions(
+		*service.Context, userId,
+	).Execute()
+
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return base.ServiceError{
+				Summary: "User with id '" + userId + "' not found",
+				Status:  http.StatusNotFound,
+			}
+		}
+		return base.NewKratosError("Error revoking user sessions", err)
+	}
+	service.Events.Publish(base.SessionRevokedEvent, userId, nil)
 	return nil
 }
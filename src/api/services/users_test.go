@@ -0,0 +1,101 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"context"
+	ory "github.com/ory/kratos-client-go"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUserNotFound(t *testing.T) {
+	kratos := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusNotFound)
+			writer.Write([]byte(`{"error":{"code":404,"message":"Not Found"}}`))
+		},
+	))
+	defer kratos.Close()
+
+	configuration := ory.NewConfiguration()
+	configuration.Servers = ory.ServerConfigurations{{URL: kratos.URL}}
+	ctx := context.Background()
+	service := &UserService{
+		Context:      &ctx,
+		KratosClient: ory.NewAPIClient(configuration),
+	}
+
+	calls := map[string]func() error{
+		"get": func() error {
+			_, err := service.GetUser("42")
+			return err
+		},
+		"set state": func() error {
+			_, err := service.SetUserState("42", base.StateInactive)
+			return err
+		},
+		"revoke sessions": func() error {
+			return service.RevokeSessions("42")
+		},
+	}
+	for name, call := range calls {
+		if status := base.ErrorStatus(call()); status != http.StatusNotFound {
+			t.Errorf("expected %s to return 404, got %d", name, status)
+		}
+	}
+}
+
+func TestUserServiceRequestContext(t *testing.T) {
+	forwarded := make(chan string, 1)
+	kratos := httptest.NewServer(http.HandlerFunc(
+		func(writer http.ResponseWriter, request *http.Request) {
+			forwarded <- request.Header.Get(base.RequestIdHeader)
+			writer.WriteHeader(http.StatusNotFound)
+		},
+	))
+	defer kratos.Close()
+
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	configuration := ory.NewConfiguration()
+	configuration.Servers = ory.ServerConfigurations{{URL: kratos.URL}}
+	configuration.HTTPClient = &http.Client{Transport: otelhttp.NewTransport(
+		&RequestIdTransport{}, otelhttp.WithTracerProvider(provider),
+	)}
+	serviceCtx := context.Background()
+	service := &UserService{
+		Context:      &serviceCtx,
+		KratosClient: ory.NewAPIClient(configuration),
+	}
+
+	if service.WithRequestContext(context.Background()) != service {
+		t.Error("expected service without request span and id")
+	}
+
+	requestCtx, requestSpan := provider.Tracer("test").Start(
+		api.ContextWithRequestId(context.Background(), "9f2c51e0a4b8d3c7"),
+		"request",
+	)
+	requestCtx, cancel := context.WithCancel(requestCtx)
+	// Kratos calls are not canceled with request
+	cancel()
+	service.WithRequestContext(requestCtx).GetUser("42")
+	requestSpan.End()
+
+	if requestId := <-forwarded; requestId != "9f2c51e0a4b8d3c7" {
+		t.Errorf("expected request id forwarded to Kratos, got %q", requestId)
+	}
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("expected Kratos call and request spans, got %d", len(ended))
+	}
+	if ended[0].Parent().SpanID() != requestSpan.SpanContext().SpanID() {
+		t.Error("Kratos call span is not a child of request span")
+	}
+}
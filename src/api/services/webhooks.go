@@ -0,0 +1,558 @@
+package services
+
+import (
+	"access-backend/api"
+	"access-backend/base"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const WebhookIdHeader string = "X-Webhook-Id"
+const WebhookEventHeader string = "X-Webhook-Event"
+const WebhookDeliveryHeader string = "X-Webhook-Delivery"
+const WebhookTimestampHeader string = "X-Webhook-Timestamp"
+const WebhookSignatureHeader string = "X-Webhook-Signature"
+
+type BaseWebhookService interface {
+	GetWebhooks() []api.WebhookResponse
+	AddWebhook(request *api.WebhookRequest) (*api.WebhookResponse, error)
+	DeleteWebhook(webhookId string) error
+	GetDeadLetters() []api.WebhookDelivery
+	Redeliver(deliveryId string) error
+	GetStats() *api.WebhookStatsResponse
+}
+
+type webhookSubscription struct {
+	base.WebhookConfig
+	Static bool `json:"-"`
+}
+
+// WebhookService delivers user events to subscribed HTTP endpoints. Body
+// is signed with subscription secret: X-Webhook-Signature header contains
+// "sha256=" and hex HMAC-SHA256 of timestamp header value, "." and body.
+// Failed deliveries are retried with exponential backoff and moved to
+// dead letters after the last attempt.
+type WebhookService struct {
+	BaseWebhookService
+	WebhooksConfig *base.WebhooksConfig
+	Client         *http.Client
+	// RestrictedClient delivers to subscriptions added with API, it does
+	// not follow redirects and connects only allowed addresses
+	RestrictedClient *http.Client
+	mutex            sync.RWMutex
+	subscriptions    []*webhookSubscription
+	deadLetters      []*api.WebhookDelivery
+	queue            chan *api.WebhookDelivery
+	queueDepth       atomic.Int64
+	delivered        atomic.Int64
+	failedAttempts   atomic.Int64
+}
+
+func NewWebhookService(config *base.WebhooksConfig) (*WebhookService, error) {
+	service := &WebhookService{
+		WebhooksConfig: config,
+		Client:         &http.Client{Timeout: config.Timeout},
+		queue:          make(chan *api.WebhookDelivery, config.QueueSize),
+	}
+	service.RestrictedClient = &http.Client{
+		Timeout: config.Timeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: config.Timeout,
+				Control: service.checkDialAddress,
+			}).DialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: config.Timeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	for _, subscription := range config.Subscriptions {
+		service.subscriptions = append(
+			service.subscriptions,
+			&webhookSubscription{WebhookConfig: subscription, Static: true},
+		)
+	}
+	if err := service.loadStore(); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+func (service *WebhookService) loadStore() error {
+	file := service.WebhooksConfig.StoreFile
+	if file == "" {
+		return nil
+	}
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("webhooks file '%s' open error. %s", file, err.Error())
+	}
+
+	var stored []*webhookSubscription
+	if err = json.Unmarshal(content, &stored); err != nil {
+		return fmt.Errorf(
+			"webhooks file '%s' reading error, invalid format. %s",
+			file,
+			err.Error(),
+		)
+	}
+	service.subscriptions = append(service.subscriptions, stored...)
+	return nil
+}
+
+func (service *WebhookService) saveStore() error {
+	if service.WebhooksConfig.StoreFile == "" {
+		return nil
+	}
+	stored := make([]*webhookSubscription, 0, len(service.subscriptions))
+	for _, subscription := range service.subscriptions {
+		if !subscription.Static {
+			stored = append(stored, subscription)
+		}
+	}
+	content, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(service.WebhooksConfig.StoreFile, content, 0600)
+}
+
+// isPrivateAddress returns true for loopback, private, link-local,
+// multicast and unspecified addresses.
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified()
+}
+
+// checkDialAddress rejects connections of subscriptions added with API to
+// private addresses. Address is checked after name resolution, so host
+// resolving to private address is rejected too.
+func (service *WebhookService) checkDialAddress(
+	network string, address string, _ syscall.RawConn,
+) error {
+	if service.WebhooksConfig.AllowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateAddress(ip) {
+		return fmt.Errorf("webhook address '%s' is not allowed", host)
+	}
+	return nil
+}
+
+// hostAllowed checks host against configured names and "*.domain" patterns.
+func (service *WebhookService) hostAllowed(host string) bool {
+	allowedHosts := service.WebhooksConfig.AllowedHosts
+	if len(allowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if domain, ok := strings.CutPrefix(allowed, "*"); ok {
+			if strings.HasSuffix(host, domain) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// validateUrl checks URL of subscription added with API against allowed
+// schemes and hosts. Private addresses are rejected here for literal IPs
+// and at dial time for resolved names.
+func (service *WebhookService) validateUrl(rawUrl string) error {
+	parsed, err := url.Parse(rawUrl)
+	var host string
+	if err == nil {
+		host = parsed.Hostname()
+	}
+	ip := net.ParseIP(host)
+	reason := ""
+	switch {
+	case host == "":
+		reason = "is invalid"
+	case parsed.User != nil:
+		reason = "can not contain credentials"
+	case !slices.Contains(service.WebhooksConfig.AllowedSchemes, parsed.Scheme):
+		reason = "scheme is not allowed"
+	case !service.hostAllowed(host):
+		reason = "host is not allowed"
+	case !service.WebhooksConfig.AllowPrivateNetworks &&
+		(strings.EqualFold(host, "localhost") || ip != nil && isPrivateAddress(ip)):
+		reason = "host is private address"
+	}
+	if reason == "" {
+		return nil
+	}
+	return base.ServiceError{
+		Summary: "Webhook URL " + reason,
+		Status:  http.StatusUnprocessableEntity,
+	}
+}
+
+func subscriptionToResponse(subscription *webhookSubscription) api.WebhookResponse {
+	return api.WebhookResponse{
+		Id:     subscription.Id,
+		Url:    subscription.Url,
+		Events: subscription.Events,
+		Static: subscription.Static,
+	}
+}
+
+func (service *WebhookService) GetWebhooks() []api.WebhookResponse {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	result := make([]api.WebhookResponse, 0, len(service.subscriptions))
+	for _, subscription := range service.subscriptions {
+		result = append(result, subscriptionToResponse(subscription))
+	}
+	return result
+}
+
+func (service *WebhookService) AddWebhook(request *api.WebhookRequest) (
+	*api.WebhookResponse, error,
+) {
+	if err := service.validateUrl(request.Url); err != nil {
+		return nil, err
+	}
+	subscription := &webhookSubscription{
+		WebhookConfig: base.WebhookConfig{
+			Id:     newEventId(),
+			Url:    request.Url,
+			Secret: request.Secret,
+			Events: request.Events,
+		},
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	service.subscriptions = append(service.subscriptions, subscription)
+	if err := service.saveStore(); err != nil {
+		service.subscriptions = service.subscriptions[:len(service.subscriptions)-1]
+		return nil, err
+	}
+
+	response := subscriptionToResponse(subscription)
+	return &response, nil
+}
+
+func (service *WebhookService) DeleteWebhook(webhookId string) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	index := slices.IndexFunc(
+		service.subscriptions,
+		func(subscription *webhookSubscription) bool {
+			return subscription.Id == webhookId
+		},
+	)
+	if index < 0 {
+		return base.ServiceError{
+			Summary: "Webhook with id '" + webhookId + "' not found",
+			Status:  http.StatusNotFound,
+		}
+	}
+	if service.subscriptions[index].Static {
+		return base.ServiceError{
+			Summary: "Webhook configured in configuration file can not be deleted",
+			Status:  http.StatusConflict,
+		}
+	}
+
+	subscriptions := slices.Delete(slices.Clone(service.subscriptions), index, index+1)
+	previous := service.subscriptions
+	service.subscriptions = subscriptions
+	if err := service.saveStore(); err != nil {
+		service.subscriptions = previous
+		return err
+	}
+	return nil
+}
+
+func (service *WebhookService) findSubscription(webhookId string) *webhookSubscription {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	for _, subscription := range service.subscriptions {
+		if subscription.Id == webhookId {
+			return subscription
+		}
+	}
+	return nil
+}
+
+func (service *WebhookService) addDeadLetter(delivery *api.WebhookDelivery) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.deadLetters = append(service.deadLetters, delivery)
+	if overflow := len(service.deadLetters) - service.WebhooksConfig.DeadLetterLimit; overflow > 0 {
+		service.deadLetters = service.deadLetters[overflow:]
+	}
+
+	base.Logger.WithFields(logrus.Fields{
+		"webhook_id":  delivery.WebhookId,
+		"delivery_id": delivery.Id,
+		"event_type":  delivery.Event.Type,
+		"attempts":    delivery.Attempts,
+		"error":       delivery.LastError,
+	}).Error("Webhook delivery moved to dead letters")
+}
+
+func (service *WebhookService) GetDeadLetters() []api.WebhookDelivery {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	result := make([]api.WebhookDelivery, 0, len(service.deadLetters))
+	for _, delivery := range service.deadLetters {
+		result = append(result, *delivery)
+	}
+	return result
+}
+
+func (service *WebhookService) Redeliver(deliveryId string) error {
+	service.mutex.Lock()
+	index := slices.IndexFunc(
+		service.deadLetters,
+		func(delivery *api.WebhookDelivery) bool {
+			return delivery.Id == deliveryId
+		},
+	)
+	if index < 0 {
+		service.mutex.Unlock()
+		return base.ServiceError{
+			Summary: "Dead letter with id '" + deliveryId + "' not found",
+			Status:  http.StatusNotFound,
+		}
+	}
+	delivery := service.deadLetters[index]
+	service.deadLetters = slices.Delete(service.deadLetters, index, index+1)
+	service.mutex.Unlock()
+
+	delivery.Attempts = 0
+	if !service.enqueue(delivery) {
+		service.addDeadLetter(delivery)
+		return base.ServiceError{
+			Summary: "Webhook delivery queue is full",
+			Status:  http.StatusServiceUnavailable,
+		}
+	}
+	return nil
+}
+
+func (service *WebhookService) GetStats() *api.WebhookStatsResponse {
+	service.mutex.RLock()
+	deadLetters := int64(len(service.deadLetters))
+	service.mutex.RUnlock()
+
+	return &api.WebhookStatsResponse{
+		QueueDepth:     service.queueDepth.Load(),
+		Delivered:      service.delivered.Load(),
+		FailedAttempts: service.failedAttempts.Load(),
+		DeadLetters:    deadLetters,
+	}
+}
+
+// QueueDepth returns number of deliveries waiting for delivery attempt.
+func (service *WebhookService) QueueDepth() int64 {
+	return service.queueDepth.Load()
+}
+
+func (service *WebhookService) enqueue(delivery *api.WebhookDelivery) bool {
+	select {
+	case service.queue <- delivery:
+		service.queueDepth.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+func (service *WebhookService) HandleEvent(event *api.UserEvent) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	for _, subscription := range service.subscriptions {
+		if !slices.Contains(subscription.Events, event.Type) {
+			continue
+		}
+		delivery := &api.WebhookDelivery{
+			Id:        newEventId(),
+			WebhookId: subscription.Id,
+			Event:     *event,
+		}
+		if !service.enqueue(delivery) {
+			delivery.LastError = "Webhook delivery queue is full"
+			go service.addDeadLetter(delivery)
+		}
+	}
+}
+
+func signWebhookBody(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (service *WebhookService) send(
+	ctx context.Context,
+	subscription *webhookSubscription,
+	delivery *api.WebhookDelivery,
+) error {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, subscription.Url, bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookIdHeader, subscription.Id)
+	request.Header.Set(WebhookEventHeader, delivery.Event.Type)
+	request.Header.Set(WebhookDeliveryHeader, delivery.Id)
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(
+		WebhookSignatureHeader,
+		signWebhookBody(subscription.Secret, timestamp, body),
+	)
+
+	client := service.Client
+	if !subscription.Static {
+		client = service.RestrictedClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+	return nil
+}
+
+func (service *WebhookService) backoff(attempts int) time.Duration {
+	delay := service.WebhooksConfig.InitialBackoff
+	for i := 1; i < attempts && delay < service.WebhooksConfig.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, service.WebhooksConfig.MaxBackoff)
+}
+
+func (service *WebhookService) deliver(
+	ctx context.Context, delivery *api.WebhookDelivery,
+) {
+	subscription := service.findSubscription(delivery.WebhookId)
+	if subscription == nil {
+		base.Logger.WithFields(logrus.Fields{
+			"webhook_id":  delivery.WebhookId,
+			"delivery_id": delivery.Id,
+		}).Warn("Webhook removed, delivery dropped")
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = time.Now().UTC()
+	logFields := logrus.Fields{
+		"webhook_id":  delivery.WebhookId,
+		"delivery_id": delivery.Id,
+		"event_type":  delivery.Event.Type,
+		"attempt":     delivery.Attempts,
+	}
+
+	start := time.Now()
+	err := service.send(ctx, subscription, delivery)
+	result := base.WebhookDelivered
+	switch {
+	case err == nil:
+	case delivery.Attempts >= service.WebhooksConfig.MaxAttempts:
+		result = base.WebhookDeadLetter
+	default:
+		result = base.WebhookRetried
+	}
+	base.WebhookDeliveryDuration.WithLabelValues(result).Observe(
+		time.Since(start).Seconds(),
+	)
+	base.WebhookDeliveriesTotal.WithLabelValues(result).Inc()
+
+	if err == nil {
+		service.delivered.Add(1)
+		base.Logger.WithFields(logFields).Info("Webhook delivered")
+		return
+	}
+	service.failedAttempts.Add(1)
+	delivery.LastError = err.Error()
+	logFields["error"] = err.Error()
+	base.Logger.WithFields(logFields).Warn("Webhook delivery attempt failed")
+
+	if result == base.WebhookDeadLetter {
+		service.addDeadLetter(delivery)
+		return
+	}
+	time.AfterFunc(service.backoff(delivery.Attempts), func() {
+		if ctx.Err() != nil || !service.enqueue(delivery) {
+			delivery.LastError = "Webhook delivery was not retried"
+			service.addDeadLetter(delivery)
+		}
+	})
+}
+
+// Run starts delivery workers, which stop when context is canceled.
+func (service *WebhookService) Run(ctx context.Context) {
+	var workers sync.WaitGroup
+	for i := 0; i < service.WebhooksConfig.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery := <-service.queue:
+					service.queueDepth.Add(-1)
+					service.deliver(ctx, delivery)
+				}
+			}
+		}()
+	}
+	workers.Wait()
+}
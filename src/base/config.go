@@ -6,10 +6,141 @@ import (
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 	"os"
+	"slices"
+	"time"
 )
 
+type TokenConfig struct {
+	Name  string `yaml:"name" validate:"required"`
+	Token string `yaml:"token" validate:"required"`
+	Role  string `yaml:"role" validate:"required"`
+}
+
+type SigningKeyConfig struct {
+	Id     string `yaml:"id" validate:"required"`
+	Secret string `yaml:"secret" validate:"required,min=32"`
+	Role   string `yaml:"role" validate:"required"`
+}
+
+type RedisConfig struct {
+	Address   string `yaml:"address" validate:"required"`
+	Password  string `yaml:"password"`
+	Database  int    `yaml:"database" validate:"gte=0"`
+	KeyPrefix string `yaml:"keyPrefix"`
+}
+
+type LockoutConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	MaxFailures int64         `yaml:"maxFailures" validate:"gte=1"`
+	BaseDelay   time.Duration `yaml:"baseDelay" validate:"gt=0"`
+	MaxDelay    time.Duration `yaml:"maxDelay" validate:"gtefield=BaseDelay"`
+	Window      time.Duration `yaml:"window" validate:"gt=0"`
+	Store       string        `yaml:"store" validate:"oneof=memory redis"`
+	Redis       *RedisConfig  `yaml:"redis" validate:"required_if=Store redis,omitempty"`
+	// Reject authorization with 503, if attempts store is unavailable.
+	// Otherwise failures are only logged and requests are not limited
+	FailClosed bool `yaml:"failClosed"`
+}
+
+type TokenExchangeConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Secret         string        `yaml:"secret" validate:"required_if=Enabled true,omitempty,min=32"`
+	DefaultTtl     time.Duration `yaml:"defaultTtl" validate:"gt=0,ltefield=MaxTtl"`
+	MaxTtl         time.Duration `yaml:"maxTtl" validate:"gt=0"`
+	RevocationFile string        `yaml:"revocationFile"`
+}
+
 type AuthorizationConfig struct {
-	AccessToken string `yaml:"accessToken" validate:"required"`
+	AccessToken     string                  `yaml:"accessToken" validate:"required_without=Tokens"`
+	AccessTokenRole string                  `yaml:"accessTokenRole" validate:"required"`
+	Tokens          []TokenConfig           `yaml:"tokens" validate:"dive"`
+	Roles           map[string][]Permission `yaml:"roles" validate:"required"`
+	Lockout         LockoutConfig           `yaml:"lockout"`
+	SigningKeys     []SigningKeyConfig      `yaml:"signingKeys" validate:"dive"`
+	MaxClockSkew    time.Duration           `yaml:"maxClockSkew" validate:"gt=0"`
+	// Body of signed request is read before signature is verified, so it
+	// is limited to this number of bytes
+	MaxSignedBodySize int64               `yaml:"maxSignedBodySize" validate:"gt=0"`
+	Exchange          TokenExchangeConfig `yaml:"exchange"`
+}
+
+func defaultRoles() map[string][]Permission {
+	return map[string][]Permission{
+		ViewerRole: {ReadUsersPermission},
+		OperatorRole: {
+			ReadUsersPermission,
+			CreateUsersPermission,
+			DeactivateUsersPermission,
+		},
+		AdminRole: slices.Clone(AllPermissions),
+	}
+}
+
+func (cfg *AuthorizationConfig) validateRoles() error {
+	for role, permissions := range cfg.Roles {
+		for _, permission := range permissions {
+			if !slices.Contains(AllPermissions, permission) {
+				return fmt.Errorf(
+					"unknown permission '%s' for role '%s'", permission, role,
+				)
+			}
+		}
+	}
+	if _, ok := cfg.Roles[cfg.AccessTokenRole]; !ok {
+		return fmt.Errorf(
+			"unknown role '%s' for access token", cfg.AccessTokenRole,
+		)
+	}
+	for _, token := range cfg.Tokens {
+		if _, ok := cfg.Roles[token.Role]; !ok {
+			return fmt.Errorf(
+				"unknown role '%s' for token '%s'", token.Role, token.Name,
+			)
+		}
+	}
+	for _, key := range cfg.SigningKeys {
+		if _, ok := cfg.Roles[key.Role]; !ok {
+			return fmt.Errorf(
+				"unknown role '%s' for signing key '%s'", key.Role, key.Id,
+			)
+		}
+	}
+	return nil
+}
+
+type TlsConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"certFile" validate:"required_if=Enabled true"`
+	KeyFile  string `yaml:"keyFile" validate:"required_if=Enabled true"`
+	// Minimal TLS version, "1.2" or "1.3"
+	MinVersion string `yaml:"minVersion" validate:"oneof=1.2 1.3"`
+	// Names of TLS 1.2 cipher suites, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+	// Go defaults are used if empty, TLS 1.3 suites are not configurable
+	CipherSuites []string `yaml:"cipherSuites"`
+	// Interval of checking certificate files for changes, certificate is
+	// also reloaded on SIGHUP
+	ReloadInterval time.Duration `yaml:"reloadInterval" validate:"gt=0"`
+	// Optional plain HTTP listener, which redirects requests to HTTPS
+	RedirectSocket string `yaml:"redirectSocket" validate:"omitempty,unix_addr"`
+}
+
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path of Prometheus endpoint. It is served by operations listener if
+	// it is enabled, otherwise by the main listener without base path with
+	// operations token
+	Path string `yaml:"path" validate:"required_if=Enabled true"`
+}
+
+type OpsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Address of listener for liveness, readiness, metrics, pprof and
+	// build info endpoints
+	Socket string `yaml:"socket" validate:"required_if=Enabled true,omitempty,unix_addr"`
+	// Optional bearer token required by all operational endpoints
+	Token string `yaml:"token"`
+	// Serve runtime profiles on /debug/pprof
+	Pprof bool `yaml:"pprof"`
 }
 
 type ServerConfig struct {
@@ -17,22 +148,232 @@ type ServerConfig struct {
 	BasePath               string `yaml:"basePath"`
 	OpenapiBasePath        string `yaml:"openapiBasePath"`
 	PaginationDefaultLimit int64  `yaml:"paginationDefaultLimit" validate:"required,gt=1"`
+	// Time between shutdown signal and closing listener, while health check
+	// reports "shutting down", so load balancers stop sending requests
+	ShutdownDelay time.Duration `yaml:"shutdownDelay" validate:"gte=0"`
+	// Time to finish in-flight requests and then to stop background workers
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" validate:"gt=0"`
+	Tls             TlsConfig     `yaml:"tls"`
+	Ops             OpsConfig     `yaml:"ops"`
+	Metrics         MetricsConfig `yaml:"metrics"`
+	// Addresses or CIDRs of proxies, which X-Forwarded-For and X-Real-IP
+	// headers are trusted for client IP. No proxies are trusted if empty
+	TrustedProxies []string `yaml:"trustedProxies" validate:"dive,cidr|ip"`
+}
+
+type KratosHooksConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Secret sent by Kratos in X-Kratos-Hook-Secret header or used as
+	// HMAC-SHA256 key of X-Kratos-Hook-Signature header
+	Secret string `yaml:"secret" validate:"required_if=Enabled true"`
+	// Maximal size of hook request body in bytes
+	MaxBodySize int64 `yaml:"maxBodySize" validate:"gt=0"`
+	// Reject password flows, which UI did not pass password to validation
+	// hook in transient_payload
+	RequirePassword bool `yaml:"requirePassword"`
 }
 
 type KratosConfig struct {
-	AdminApiUrl string `yaml:"adminApiUrl" validate:"required"`
+	AdminApiUrl string            `yaml:"adminApiUrl" validate:"required"`
+	Hooks       KratosHooksConfig `yaml:"hooks"`
+}
+
+type AccessLogConfig struct {
+	// Request paths or route templates, which are not logged unless
+	// request fails or is slow, e.g. health checks
+	SkipPaths []string `yaml:"skipPaths"`
+	// Request headers added to access log entry
+	Headers []string `yaml:"headers"`
+	// Headers, which values are replaced with "[REDACTED]"
+	RedactHeaders []string `yaml:"redactHeaders"`
+	// Requests taking longer are logged with warn level, 0 disables it
+	SlowThreshold time.Duration `yaml:"slowThreshold" validate:"gte=0"`
+}
+
+type LogSinkConfig struct {
+	// "stdout", "file", "syslog" or "gelf"
+	Type string `yaml:"type" validate:"oneof=stdout file syslog gelf"`
+	// Minimal level of entries written to the sink, logs.level if empty
+	Level string `yaml:"level" validate:"omitempty,oneof=fatal error warn warning info debug trace"`
+	// Format of entries, logs.format if empty. Syslog messages contain
+	// entries in this format, GELF sink has its own format
+	Format string `yaml:"format" validate:"omitempty,oneof=json logfmt text"`
+	// Log file, it is rotated when it exceeds MaxSize megabytes. Rotated
+	// files older than MaxAge or beyond MaxBackups newest are removed,
+	// zero values disable limits
+	File       string        `yaml:"file" validate:"required_if=Type file"`
+	MaxSize    int64         `yaml:"maxSize" validate:"gte=0"`
+	MaxAge     time.Duration `yaml:"maxAge" validate:"gte=0"`
+	MaxBackups int           `yaml:"maxBackups" validate:"gte=0"`
+	// Network of syslog or GELF server, "udp" if empty. Syslog server
+	// also can listen on "unix" socket
+	Network string `yaml:"network" validate:"omitempty,oneof=udp tcp unix"`
+	Address string `yaml:"address" validate:"required_if=Type syslog,required_if=Type gelf"`
+	// Syslog facility, "local0" if empty
+	Facility string `yaml:"facility" validate:"omitempty,oneof=kern user mail daemon auth syslog lpr news uucp cron authpriv ftp local0 local1 local2 local3 local4 local5 local6 local7"`
 }
 
 type LogConfig struct {
 	Level   string `yaml:"level" validate:"required,oneof=fatal error warn warning info debug trace"`
 	AppName string `yaml:"appName" validate:"required"`
+	// Format of entries: "json", "logfmt" or human-readable "text"
+	Format string          `yaml:"format" validate:"oneof=json logfmt text"`
+	Access AccessLogConfig `yaml:"access"`
+	// Outputs of entries, stdout is used if empty
+	Sinks []LogSinkConfig `yaml:"sinks" validate:"dive"`
+	// Longest time, after which level changed at runtime is reverted, it
+	// is also used when TTL is not requested. 0 allows keeping level
+	MaxLevelTtl time.Duration `yaml:"maxLevelTtl" validate:"gte=0"`
+	// Level changed by SIGUSR1 or SIGUSR2 is reverted after this time, 0
+	// keeps it until the next change
+	SignalLevelTtl time.Duration `yaml:"signalLevelTtl" validate:"gte=0"`
+}
+
+type PolicyConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Files          []string      `yaml:"files" validate:"required_if=Enabled true"`
+	ReloadInterval time.Duration `yaml:"reloadInterval" validate:"gt=0"`
+}
+
+type AuditConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Sink         string   `yaml:"sink" validate:"oneof=file postgres"`
+	File         string   `yaml:"file" validate:"required_if=Sink file"`
+	PostgresDsn  string   `yaml:"postgresDsn" validate:"required_if=Sink postgres"`
+	RedactFields []string `yaml:"redactFields"`
+	// Base64 encoded Ed25519 seed or private key signing audit checkpoints
+	CheckpointKey string `yaml:"checkpointKey" validate:"omitempty,base64"`
+	// Base64 encoded Ed25519 public key verifying audit checkpoints, so
+	// chain can be verified without the signing key
+	CheckpointPublicKey string        `yaml:"checkpointPublicKey" validate:"omitempty,base64"`
+	CheckpointInterval  time.Duration `yaml:"checkpointInterval" validate:"gt=0"`
+}
+
+type WebhookConfig struct {
+	Id     string   `yaml:"id" json:"id" validate:"required"`
+	Url    string   `yaml:"url" json:"url" validate:"required,url"`
+	Secret string   `yaml:"secret" json:"secret" validate:"required"`
+	Events []string `yaml:"events" json:"events" validate:"required,min=1,dive,oneof=user.created user.updated user.deactivated user.deleted"`
+}
+
+type WebhooksConfig struct {
+	Subscriptions   []WebhookConfig `yaml:"subscriptions" validate:"dive"`
+	StoreFile       string          `yaml:"storeFile"`
+	Timeout         time.Duration   `yaml:"timeout" validate:"gt=0"`
+	MaxAttempts     int             `yaml:"maxAttempts" validate:"gte=1"`
+	InitialBackoff  time.Duration   `yaml:"initialBackoff" validate:"gt=0"`
+	MaxBackoff      time.Duration   `yaml:"maxBackoff" validate:"gtefield=InitialBackoff"`
+	Workers         int             `yaml:"workers" validate:"gte=1"`
+	QueueSize       int             `yaml:"queueSize" validate:"gte=1"`
+	DeadLetterLimit int             `yaml:"deadLetterLimit" validate:"gte=1"`
+	// URL schemes of subscriptions added with API, configured
+	// subscriptions are trusted
+	AllowedSchemes []string `yaml:"allowedSchemes" validate:"min=1,dive,oneof=http https"`
+	// Host names or "*.example.com" patterns of subscriptions added with
+	// API, any host is allowed if empty
+	AllowedHosts []string `yaml:"allowedHosts" validate:"dive,hostname|fqdn|startswith=*."`
+	// Allow subscriptions added with API to connect loopback, private and
+	// link-local addresses
+	AllowPrivateNetworks bool `yaml:"allowPrivateNetworks"`
+}
+
+type EventStreamConfig struct {
+	BufferSize        int           `yaml:"bufferSize" validate:"gte=1"`
+	ClientBufferSize  int           `yaml:"clientBufferSize" validate:"gte=1"`
+	HeartbeatInterval time.Duration `yaml:"heartbeatInterval" validate:"gt=0"`
+}
+
+type OutboxConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Store       string `yaml:"store" validate:"oneof=file postgres"`
+	File        string `yaml:"file" validate:"required_if=Store file"`
+	PostgresDsn string `yaml:"postgresDsn" validate:"required_if=Store postgres"`
+	Broker      string `yaml:"broker" validate:"oneof=nats kafka file stdout"`
+	// NATS subject or Kafka topic of published events
+	Subject         string        `yaml:"subject" validate:"required"`
+	NatsUrl         string        `yaml:"natsUrl" validate:"required_if=Broker nats"`
+	NatsJetStream   bool          `yaml:"natsJetStream"`
+	KafkaBrokers    []string      `yaml:"kafkaBrokers" validate:"required_if=Broker kafka"`
+	BrokerFile      string        `yaml:"brokerFile" validate:"required_if=Broker file"`
+	BatchSize       int           `yaml:"batchSize" validate:"gte=1"`
+	PollInterval    time.Duration `yaml:"pollInterval" validate:"gt=0"`
+	PublishTimeout  time.Duration `yaml:"publishTimeout" validate:"gt=0"`
+	InitialBackoff  time.Duration `yaml:"initialBackoff" validate:"gt=0"`
+	MaxBackoff      time.Duration `yaml:"maxBackoff" validate:"gtefield=InitialBackoff"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" validate:"gt=0"`
+	// Number of events kept in memory until they are recorded in store
+	RetryBufferSize int `yaml:"retryBufferSize" validate:"gte=1"`
+	// Timeout of recording event in store
+	RecordTimeout time.Duration `yaml:"recordTimeout" validate:"gt=0"`
+}
+
+type ReconcilerConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Interval     time.Duration `yaml:"interval" validate:"gt=0"`
+	PageSize     int64         `yaml:"pageSize" validate:"gte=1,lte=1000"`
+	SnapshotFile string        `yaml:"snapshotFile" validate:"required"`
+}
+
+type HistoryConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	File    string `yaml:"file" validate:"required_if=Enabled true"`
+	// Number of latest versions kept for every user
+	MaxVersions int `yaml:"maxVersions" validate:"gte=1"`
+}
+
+type DeletionHookConfig struct {
+	Name string `yaml:"name" validate:"required,ne=kratos"`
+	// URL called with POST and JSON body with user_id
+	Url     string        `yaml:"url" validate:"required,url"`
+	Secret  string        `yaml:"secret" validate:"required"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type DeletionConfig struct {
+	Enabled        bool                 `yaml:"enabled"`
+	Hooks          []DeletionHookConfig `yaml:"hooks" validate:"dive"`
+	StoreFile      string               `yaml:"storeFile" validate:"required_if=Enabled true"`
+	Timeout        time.Duration        `yaml:"timeout" validate:"gt=0"`
+	MaxAttempts    int                  `yaml:"maxAttempts" validate:"gte=1"`
+	InitialBackoff time.Duration        `yaml:"initialBackoff" validate:"gt=0"`
+	MaxBackoff     time.Duration        `yaml:"maxBackoff" validate:"gtefield=InitialBackoff"`
+	// Time completed deletions are kept in store file
+	Retention time.Duration `yaml:"retention" validate:"gte=0"`
+}
+
+type HealthConfig struct {
+	// Time readiness check results are reused
+	CacheTtl time.Duration `yaml:"cacheTtl" validate:"gte=0"`
+	// Timeout of every dependency check
+	Timeout time.Duration `yaml:"timeout" validate:"gt=0"`
+}
+
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// otlpgrpc, otlphttp or stdout
+	Exporter string `yaml:"exporter" validate:"oneof=otlpgrpc otlphttp stdout"`
+	// Collector host and port, OTEL_EXPORTER_OTLP_ENDPOINT is used if empty
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"serviceName" validate:"required"`
+	SampleRatio float64 `yaml:"sampleRatio" validate:"gte=0,lte=1"`
 }
 
 type BackendConfig struct {
-	Server ServerConfig        `yaml:"server"`
-	Logs   LogConfig           `yaml:"logs"`
-	Kratos KratosConfig        `yaml:"kratos"`
-	Auth   AuthorizationConfig `yaml:"authorization"`
+	Server     ServerConfig        `yaml:"server"`
+	Logs       LogConfig           `yaml:"logs"`
+	Kratos     KratosConfig        `yaml:"kratos"`
+	Auth       AuthorizationConfig `yaml:"authorization"`
+	Policy     PolicyConfig        `yaml:"policy"`
+	Audit      AuditConfig         `yaml:"audit"`
+	Webhooks   WebhooksConfig      `yaml:"webhooks"`
+	Stream     EventStreamConfig   `yaml:"eventStream"`
+	Outbox     OutboxConfig        `yaml:"outbox"`
+	Reconciler ReconcilerConfig    `yaml:"reconciler"`
+	History    HistoryConfig       `yaml:"history"`
+	Deletion   DeletionConfig      `yaml:"deletion"`
+	Health     HealthConfig        `yaml:"health"`
+	Tracing    TracingConfig       `yaml:"tracing"`
 }
 
 func LoadConfiguration(file string) (*BackendConfig, error) {
@@ -45,6 +386,11 @@ func LoadConfiguration(file string) (*BackendConfig, error) {
 	if err := cfg.loadFromFile(file); err != nil {
 		return nil, err
 	}
+	// Decoder merges configured roles into existing map, so default roles
+	// are set only if roles are not configured
+	if cfg.Auth.Roles == nil {
+		cfg.Auth.Roles = defaultRoles()
+	}
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
@@ -57,11 +403,91 @@ func (cfg *BackendConfig) SetDefaults() {
 	cfg.Server.BasePath = "/backend"
 	cfg.Server.OpenapiBasePath = "/swagger"
 	cfg.Server.PaginationDefaultLimit = 20
+	cfg.Server.ShutdownTimeout = 30 * time.Second
+	cfg.Server.Tls.MinVersion = "1.2"
+	cfg.Server.Tls.ReloadInterval = 30 * time.Second
+	cfg.Server.Ops.Socket = "127.0.0.1:9000"
+	cfg.Server.Metrics.Path = "/metrics"
+
+	cfg.Kratos.Hooks.MaxBodySize = 1 << 20
 
 	cfg.Logs.Level = logrus.DebugLevel.String()
 	cfg.Logs.AppName = "sharing-backend"
+	cfg.Logs.Format = "json"
+	cfg.Logs.Access.RedactHeaders = []string{
+		"Authorization",
+		"Cookie",
+		"X-Kratos-Hook-Secret",
+		"X-Kratos-Hook-Signature",
+	}
+	cfg.Logs.Access.SlowThreshold = time.Second
 
 	cfg.Kratos.AdminApiUrl = "http://127.0.0.1:4434"
+
+	cfg.Auth.AccessTokenRole = AdminRole
+	cfg.Auth.Lockout.Enabled = true
+	cfg.Auth.Lockout.MaxFailures = 5
+	cfg.Auth.Lockout.BaseDelay = time.Second
+	cfg.Auth.Lockout.MaxDelay = 15 * time.Minute
+	cfg.Auth.Lockout.Window = 15 * time.Minute
+	cfg.Auth.Lockout.Store = "memory"
+	cfg.Auth.MaxClockSkew = 5 * time.Minute
+	cfg.Auth.MaxSignedBodySize = 1 << 20
+	cfg.Auth.Exchange.DefaultTtl = 15 * time.Minute
+	cfg.Auth.Exchange.MaxTtl = 24 * time.Hour
+
+	cfg.Policy.ReloadInterval = 10 * time.Second
+
+	cfg.Audit.Sink = "file"
+	cfg.Audit.File = "audit.log"
+	cfg.Audit.CheckpointInterval = time.Hour
+
+	cfg.Webhooks.Timeout = 10 * time.Second
+	cfg.Webhooks.MaxAttempts = 8
+	cfg.Webhooks.InitialBackoff = time.Second
+	cfg.Webhooks.MaxBackoff = 10 * time.Minute
+	cfg.Webhooks.Workers = 4
+	cfg.Webhooks.QueueSize = 1000
+	cfg.Webhooks.DeadLetterLimit = 1000
+	cfg.Webhooks.AllowedSchemes = []string{"https"}
+
+	cfg.Stream.BufferSize = 1000
+	cfg.Stream.ClientBufferSize = 100
+	cfg.Stream.HeartbeatInterval = 15 * time.Second
+
+	cfg.Outbox.Store = "file"
+	cfg.Outbox.File = "outbox.log"
+	cfg.Outbox.Broker = "stdout"
+	cfg.Outbox.Subject = "users.events"
+	cfg.Outbox.BatchSize = 100
+	cfg.Outbox.PollInterval = 5 * time.Second
+	cfg.Outbox.PublishTimeout = 10 * time.Second
+	cfg.Outbox.InitialBackoff = time.Second
+	cfg.Outbox.MaxBackoff = 5 * time.Minute
+	cfg.Outbox.ShutdownTimeout = 10 * time.Second
+	cfg.Outbox.RetryBufferSize = 1000
+	cfg.Outbox.RecordTimeout = 5 * time.Second
+
+	cfg.Reconciler.Interval = time.Minute
+	cfg.Reconciler.PageSize = 250
+	cfg.Reconciler.SnapshotFile = "identities-snapshot.json"
+
+	cfg.History.File = "history.log"
+	cfg.History.MaxVersions = 100
+
+	cfg.Deletion.StoreFile = "deletions.json"
+	cfg.Deletion.Timeout = 10 * time.Second
+	cfg.Deletion.MaxAttempts = 5
+	cfg.Deletion.InitialBackoff = time.Second
+	cfg.Deletion.MaxBackoff = time.Minute
+	cfg.Deletion.Retention = 24 * time.Hour
+
+	cfg.Health.CacheTtl = 5 * time.Second
+	cfg.Health.Timeout = 2 * time.Second
+
+	cfg.Tracing.Exporter = "stdout"
+	cfg.Tracing.ServiceName = "access-backend"
+	cfg.Tracing.SampleRatio = 1
 }
 
 func (cfg *BackendConfig) loadFromFile(file string) error {
@@ -87,5 +513,8 @@ func (cfg *BackendConfig) validate() error {
 	if err := validatorObj.Struct(cfg); err != nil {
 		return WrapValidationErrors(err)
 	}
+	if err := cfg.Auth.validateRoles(); err != nil {
+		return WrapValidationErrors(err)
+	}
 	return nil
 }
@@ -0,0 +1,114 @@
+package base
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func loadTestConfiguration(t *testing.T, content string) *BackendConfig {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("config file error: %s", err)
+	}
+	cfg, err := LoadConfiguration(file)
+	if err != nil {
+		t.Fatalf("configuration error: %+v", err)
+	}
+	return cfg
+}
+
+func TestDefaultRoles(t *testing.T) {
+	cfg := loadTestConfiguration(
+		t, "authorization:\n  accessToken: \"sksjdhdhdeye6736272jHDHD81JSu2\"\n",
+	)
+	if len(cfg.Auth.Roles) != 3 ||
+		!slices.Equal(cfg.Auth.Roles[AdminRole], AllPermissions) {
+		t.Fatalf("expected default roles, got %v", cfg.Auth.Roles)
+	}
+
+	// changing admin role does not change list of all permissions
+	cfg.Auth.Roles[AdminRole][0] = ManageLogsPermission
+	if AllPermissions[0] != ReadUsersPermission {
+		t.Errorf("admin role shares permissions with AllPermissions")
+	}
+}
+
+func TestConfiguredRolesReplaceDefaults(t *testing.T) {
+	cfg := loadTestConfiguration(t, `
+authorization:
+  accessToken: "sksjdhdhdeye6736272jHDHD81JSu2"
+  accessTokenRole: "support"
+  roles:
+    support: ["users:read", "users:deactivate"]
+`)
+	expected := []Permission{ReadUsersPermission, DeactivateUsersPermission}
+	if len(cfg.Auth.Roles) != 1 ||
+		!slices.Equal(cfg.Auth.Roles["support"], expected) {
+		t.Errorf("expected only configured role, got %v", cfg.Auth.Roles)
+	}
+}
+
+func TestValidateRoles(t *testing.T) {
+	roles := map[string][]Permission{
+		ViewerRole: {ReadUsersPermission},
+		AdminRole:  {ReadUsersPermission, ManageLogsPermission},
+	}
+	tests := []struct {
+		name   string
+		config AuthorizationConfig
+		valid  bool
+	}{
+		{
+			name: "valid",
+			config: AuthorizationConfig{
+				AccessTokenRole: AdminRole,
+				Tokens:          []TokenConfig{{Name: "dashboard", Role: ViewerRole}},
+				SigningKeys:     []SigningKeyConfig{{Id: "ci", Role: AdminRole}},
+				Roles:           roles,
+			},
+			valid: true,
+		},
+		{
+			name: "unknown permission",
+			config: AuthorizationConfig{
+				AccessTokenRole: ViewerRole,
+				Roles: map[string][]Permission{
+					ViewerRole: {ReadUsersPermission, "users:everything"},
+				},
+			},
+		},
+		{
+			name: "unknown access token role",
+			config: AuthorizationConfig{
+				AccessTokenRole: OperatorRole,
+				Roles:           roles,
+			},
+		},
+		{
+			name: "unknown token role",
+			config: AuthorizationConfig{
+				AccessTokenRole: AdminRole,
+				Tokens:          []TokenConfig{{Name: "dashboard", Role: "support"}},
+				Roles:           roles,
+			},
+		},
+		{
+			name: "unknown signing key role",
+			config: AuthorizationConfig{
+				AccessTokenRole: AdminRole,
+				SigningKeys:     []SigningKeyConfig{{Id: "ci", Role: OperatorRole}},
+				Roles:           roles,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.validateRoles()
+			if test.valid != (err == nil) {
+				t.Errorf("expected valid %t, got error %v", test.valid, err)
+			}
+		})
+	}
+}
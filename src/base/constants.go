@@ -1,14 +1,51 @@
 package base
 
 type SchemaProperty string
+type Permission string
 
 const ConfigFile string = "config.yaml"
+const ProfileNamePathParam string = "profile"
 const LimitQueryParam string = "limit"
 const PageTokenQueryParam string = "page_token"
 const UserIdPathParam string = "user_id"
+const ActorQueryParam string = "actor"
+const TargetQueryParam string = "target"
+const ActionQueryParam string = "action"
+const FromQueryParam string = "from"
+const ToQueryParam string = "to"
+const RequestIdHeader string = "X-Request-ID"
+const LastEventIdHeader string = "Last-Event-ID"
+const WebhookIdPathParam string = "webhook_id"
+const DeliveryIdPathParam string = "delivery_id"
+const KratosFlowPathParam string = "flow"
+const VersionPathParam string = "version"
+const KratosHookSecretHeader string = "X-Kratos-Hook-Secret"
+const KratosHookSignatureHeader string = "X-Kratos-Hook-Signature"
 
 const UserSchemaId string = "user"
 const PaginationHeader string = "Link"
+const AuthContextKey string = "auth"
+const RequestIdContextKey string = "request_id"
+const LoggerContextKey string = "logger"
+
+const (
+	StateActive   string = "active"
+	StateInactive string = "inactive"
+)
+
+const (
+	HealthStatusOk           string = "ok"
+	HealthStatusShuttingDown string = "shutting down"
+	HealthStatusUnavailable  string = "unavailable"
+)
+
+const (
+	KratosHealthCheck       string = "kratos"
+	KratosSchemaHealthCheck string = "kratos_schema"
+	AuditHealthCheck        string = "audit"
+	OutboxHealthCheck       string = "outbox"
+	LockoutHealthCheck      string = "lockout"
+)
 
 const (
 	Username  SchemaProperty = "username"
@@ -16,3 +53,113 @@ const (
 	FirstName SchemaProperty = "firstname"
 	LastName  SchemaProperty = "lastname"
 )
+
+// UserSchemaTraits are traits of Kratos identity schema mapped to user
+var UserSchemaTraits = []SchemaProperty{Username, Email, FirstName, LastName}
+
+const (
+	ReadUsersPermission       Permission = "users:read"
+	CreateUsersPermission     Permission = "users:create"
+	DeactivateUsersPermission Permission = "users:deactivate"
+	DeleteUsersPermission     Permission = "users:delete"
+	UpdateUsersPermission     Permission = "users:update"
+	ManageKeysPermission      Permission = "keys:manage"
+	EvaluatePolicyPermission  Permission = "policies:evaluate"
+	ReadAuditPermission       Permission = "audit:read"
+	ManageWebhooksPermission  Permission = "webhooks:manage"
+	ManageLogsPermission      Permission = "logs:manage"
+)
+
+const (
+	ViewerRole   string = "viewer"
+	OperatorRole string = "operator"
+	AdminRole    string = "admin"
+)
+
+// Version of the service, set with -ldflags "-X access-backend/base.Version=..."
+var Version = "dev"
+
+var AllPermissions = []Permission{
+	ReadUsersPermission,
+	CreateUsersPermission,
+	DeactivateUsersPermission,
+	DeleteUsersPermission,
+	UpdateUsersPermission,
+	ManageKeysPermission,
+	EvaluatePolicyPermission,
+	ReadAuditPermission,
+	ManageWebhooksPermission,
+	ManageLogsPermission,
+}
+
+const (
+	CreateUserAction       string = "user.create"
+	DeleteUserAction       string = "user.delete"
+	DeactivateUserAction   string = "user.deactivate"
+	ActivateUserAction     string = "user.activate"
+	RevokeSessionsAction   string = "user.revoke_sessions"
+	RegisterUserAction     string = "user.register"
+	LoginUserAction        string = "user.login"
+	UpdateSettingsAction   string = "user.update_settings"
+	RecoverUserAction      string = "user.recover"
+	RestoreUserAction      string = "user.restore"
+	ResumeDeletionAction   string = "user.deletion_resume"
+	ForceDeletionAction    string = "user.deletion_force"
+	CompleteDeletionAction string = "user.deletion_complete"
+	FailDeletionAction     string = "user.deletion_fail"
+	CheckpointAction       string = "audit.checkpoint"
+	GenesisAction          string = "audit.genesis"
+	ChangeLogLevelAction   string = "logs.level_change"
+)
+
+const (
+	RegistrationFlow string = "registration"
+	LoginFlow        string = "login"
+	SettingsFlow     string = "settings"
+	RecoveryFlow     string = "recovery"
+)
+
+// States of user deletion saga and its steps
+const (
+	DeletionRunning   string = "running"
+	DeletionFailed    string = "failed"
+	DeletionCompleted string = "completed"
+	StepPending       string = "pending"
+	StepDone          string = "done"
+	StepFailed        string = "failed"
+	StepSkipped       string = "skipped"
+)
+
+// KratosDeletionStep is the last step of user deletion saga
+const KratosDeletionStep string = "kratos"
+
+// Sources of user history versions
+const (
+	ApiHistorySource        string = "api"
+	KratosHookHistorySource string = "kratos_hook"
+	ReconcilerHistorySource string = "reconciler"
+	RestoreHistorySource    string = "restore"
+	BaselineHistorySource   string = "baseline"
+)
+
+// KratosValidationMessageId is Kratos generic validation error message id
+const KratosValidationMessageId int64 = 4000001
+
+const (
+	UserCreatedEvent     string = "user.created"
+	UserUpdatedEvent     string = "user.updated"
+	UserDeactivatedEvent string = "user.deactivated"
+	UserDeletedEvent     string = "user.deleted"
+	SessionRevokedEvent  string = "session.revoked"
+)
+
+// StreamResetEvent is sent to stream client, which missed events, e.g.
+// after service restart, so it must reload users
+const StreamResetEvent string = "stream.reset"
+
+var UserEventTypes = []string{
+	UserCreatedEvent,
+	UserUpdatedEvent,
+	UserDeactivatedEvent,
+	UserDeletedEvent,
+}
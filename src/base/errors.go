@@ -76,6 +76,22 @@ func NewPathParamError(paramName string, err error) ServiceError {
 	}
 }
 
+func NewPermissionError(permission Permission) ServiceError {
+	return ServiceError{
+		Summary: fmt.Sprintf("Permission '%s' required", permission),
+		Status:  http.StatusForbidden,
+	}
+}
+
+// ErrorStatus returns HTTP status code that error is responded with.
+func ErrorStatus(err error) int {
+	var serviceError ServiceError
+	if errors.As(err, &serviceError) && serviceError.Status != 0 {
+		return serviceError.Status
+	}
+	return http.StatusInternalServerError
+}
+
 func WrapValidationErrors(err error) error {
 	var validationErr validator.ValidationErrors
 	if errors.As(err, &validationErr) {
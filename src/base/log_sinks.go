@@ -0,0 +1,428 @@
+package base
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RotatingFile is log file, which is renamed with time suffix when it
+// exceeds MaxSize bytes. Rotated files older than MaxAge or beyond
+// MaxBackups newest ones are removed. Zero limits are disabled.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	file       *os.File
+	size       int64
+}
+
+func OpenRotatingFile(
+	path string, maxSize int64, maxAge time.Duration, maxBackups int,
+) (*RotatingFile, error) {
+	file := &RotatingFile{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxAge:     maxAge,
+		MaxBackups: maxBackups,
+	}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+	file.prune()
+	return file, nil
+}
+
+func (file *RotatingFile) open() error {
+	f, err := os.OpenFile(file.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("log file '%s' open error. %s", file.Path, err.Error())
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("log file '%s' open error. %s", file.Path, err.Error())
+	}
+	file.file = f
+	file.size = info.Size()
+	return nil
+}
+
+// backupPattern returns glob pattern of rotated files, e.g. app-*.log for
+// app.log.
+func (file *RotatingFile) backupPattern() string {
+	extension := filepath.Ext(file.Path)
+	return strings.TrimSuffix(file.Path, extension) + "-*" + extension
+}
+
+func (file *RotatingFile) backupPath(now time.Time) string {
+	extension := filepath.Ext(file.Path)
+	return fmt.Sprintf(
+		"%s-%s%s",
+		strings.TrimSuffix(file.Path, extension),
+		now.UTC().Format("20060102T150405.000000000"),
+		extension,
+	)
+}
+
+// rotate renames current file and opens a new one. If renaming fails,
+// the current file is reopened, so logging continues.
+func (file *RotatingFile) rotate() error {
+	err := file.file.Close()
+	if err == nil {
+		err = os.Rename(file.Path, file.backupPath(time.Now()))
+	}
+	if openErr := file.open(); openErr != nil {
+		return openErr
+	}
+	if err != nil {
+		return fmt.Errorf(
+			"log file '%s' rotation error. %s", file.Path, err.Error(),
+		)
+	}
+	file.prune()
+	return nil
+}
+
+// prune removes rotated files exceeding age and count limits.
+func (file *RotatingFile) prune() {
+	if file.MaxAge == 0 && file.MaxBackups == 0 {
+		return
+	}
+	backups, err := filepath.Glob(file.backupPattern())
+	if err != nil {
+		return
+	}
+	// Names end with sortable time, so the newest files are the first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, backup := range backups {
+		expired := false
+		if file.MaxBackups > 0 && i >= file.MaxBackups {
+			expired = true
+		} else if file.MaxAge > 0 {
+			info, err := os.Stat(backup)
+			expired = err == nil && time.Since(info.ModTime()) > file.MaxAge
+		}
+		if expired {
+			os.Remove(backup)
+		}
+	}
+}
+
+// Write writes content to the current file, even if rotation failed, and
+// returns rotation error then.
+func (file *RotatingFile) Write(content []byte) (int, error) {
+	var rotationErr error
+	if file.MaxSize > 0 && file.size > 0 &&
+		file.size+int64(len(content)) > file.MaxSize {
+		rotationErr = file.rotate()
+	}
+	written, err := file.file.Write(content)
+	file.size += int64(written)
+	if rotationErr != nil {
+		return written, rotationErr
+	}
+	return written, err
+}
+
+// networkDialTimeout limits time of connecting to log server, and it is
+// the pause before the next attempt after connecting failed, so logging
+// is not blocked by unavailable server.
+const networkDialTimeout = 2 * time.Second
+
+// networkWriteTimeout limits time of writing message, so slow server does
+// not block logging.
+const networkWriteTimeout = time.Second
+
+// networkConnection dials server on the first write and redials it once,
+// if writing fails, so logging starts even when server is unavailable.
+// After the second failure server is not dialed for networkDialTimeout.
+type networkConnection struct {
+	Network string
+	Address string
+	conn    net.Conn
+	retryAt time.Time
+}
+
+func (connection *networkConnection) dial() error {
+	if time.Now().Before(connection.retryAt) {
+		return fmt.Errorf(
+			"log server '%s' is unavailable", connection.Address,
+		)
+	}
+	var err error
+	if connection.Network == "unix" {
+		// Local syslog daemons usually listen on datagram socket
+		connection.conn, err = net.DialTimeout(
+			"unixgram", connection.Address, networkDialTimeout,
+		)
+		if err == nil {
+			return nil
+		}
+	}
+	connection.conn, err = net.DialTimeout(
+		connection.Network, connection.Address, networkDialTimeout,
+	)
+	if err != nil {
+		connection.conn = nil
+		connection.retryAt = time.Now().Add(networkDialTimeout)
+	}
+	return err
+}
+
+func (connection *networkConnection) write(messages ...[]byte) error {
+	for attempt := 0; ; attempt++ {
+		if connection.conn == nil {
+			if err := connection.dial(); err != nil {
+				return err
+			}
+		}
+		err := connection.conn.SetWriteDeadline(
+			time.Now().Add(networkWriteTimeout),
+		)
+		for _, message := range messages {
+			if err != nil {
+				break
+			}
+			_, err = connection.conn.Write(message)
+		}
+		if err == nil {
+			return nil
+		}
+		connection.conn.Close()
+		connection.conn = nil
+		if attempt > 0 {
+			connection.retryAt = time.Now().Add(networkDialTimeout)
+			return err
+		}
+	}
+}
+
+func networkOrDefault(network string) string {
+	if network == "" {
+		return "udp"
+	}
+	return network
+}
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverity returns syslog severity of level, it is used by GELF too.
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 1
+	case logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	}
+	return 7
+}
+
+// Hostname returns host name for syslog and GELF messages.
+func Hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "-"
+	}
+	return name
+}
+
+// SyslogFormatter writes RFC 5424 message, which contains entry formatted
+// by Formatter.
+type SyslogFormatter struct {
+	Formatter logrus.Formatter
+	Facility  int
+	AppName   string
+	Host      string
+}
+
+func (formatter *SyslogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	content, err := formatter.Formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	appName := strings.ReplaceAll(formatter.AppName, " ", "_")
+	if appName == "" {
+		appName = "-"
+	}
+
+	return fmt.Appendf(
+		nil,
+		"<%d>1 %s %s %.48s %d - - %s",
+		formatter.Facility*8+syslogSeverity(entry.Level),
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		formatter.Host,
+		appName,
+		os.Getpid(),
+		bytes.TrimRight(content, "\n"),
+	), nil
+}
+
+// SyslogWriter sends messages to syslog server. Messages sent over TCP are
+// framed with octet counting as defined by RFC 6587.
+type SyslogWriter struct {
+	connection networkConnection
+}
+
+func NewSyslogWriter(network, address string) *SyslogWriter {
+	return &SyslogWriter{connection: networkConnection{
+		Network: networkOrDefault(network),
+		Address: address,
+	}}
+}
+
+func (writer *SyslogWriter) Write(message []byte) (int, error) {
+	frame := message
+	if writer.connection.Network == "tcp" {
+		frame = fmt.Appendf(nil, "%d %s", len(message), message)
+	}
+	if err := writer.connection.write(frame); err != nil {
+		return 0, err
+	}
+	return len(message), nil
+}
+
+// gelfReservedFields can not be sent as additional fields.
+var gelfReservedFields = map[string]bool{"id": true}
+
+// GelfFormatter writes entries as GELF 1.1 messages. Entry fields are sent
+// as additional fields, values other than strings and numbers are encoded
+// as JSON strings.
+type GelfFormatter struct {
+	Host string
+}
+
+func gelfValue(value any) any {
+	switch typed := value.(type) {
+	case string, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return typed
+	case error:
+		return typed.Error()
+	case fmt.Stringer:
+		return typed.String()
+	}
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(content)
+}
+
+func (formatter *GelfFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	message := map[string]any{
+		"version":       "1.1",
+		"host":          formatter.Host,
+		"short_message": entry.Message,
+		"timestamp":     float64(entry.Time.UnixMicro()) / 1e6,
+		"level":         syslogSeverity(entry.Level),
+	}
+	for key, value := range entry.Data {
+		if gelfReservedFields[key] {
+			key = "field_" + key
+		}
+		message["_"+key] = gelfValue(value)
+	}
+	return json.Marshal(message)
+}
+
+const (
+	gelfChunkSize = 8192
+	gelfMaxChunks = 128
+	// Chunk header: magic bytes, message id, sequence number and count
+	gelfChunkHeaderSize = 12
+)
+
+// GelfWriter sends GELF messages. UDP messages exceeding chunk size are
+// chunked, TCP messages are terminated by null byte.
+type GelfWriter struct {
+	connection networkConnection
+}
+
+func NewGelfWriter(network, address string) *GelfWriter {
+	return &GelfWriter{connection: networkConnection{
+		Network: networkOrDefault(network),
+		Address: address,
+	}}
+}
+
+func gelfChunks(message []byte) ([][]byte, error) {
+	payloadSize := gelfChunkSize - gelfChunkHeaderSize
+	count := (len(message) + payloadSize - 1) / payloadSize
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf(
+			"GELF message of %d bytes exceeds %d chunks",
+			len(message),
+			gelfMaxChunks,
+		)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		payload := message[i*payloadSize : min((i+1)*payloadSize, len(message))]
+		chunk := make([]byte, 0, gelfChunkHeaderSize+len(payload))
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, payload...))
+	}
+	return chunks, nil
+}
+
+func (writer *GelfWriter) Write(message []byte) (int, error) {
+	var frames [][]byte
+	switch {
+	case writer.connection.Network == "tcp":
+		frames = [][]byte{append(message, 0)}
+	case len(message) > gelfChunkSize:
+		var err error
+		if frames, err = gelfChunks(message); err != nil {
+			return 0, err
+		}
+	default:
+		frames = [][]byte{message}
+	}
+	if err := writer.connection.write(frames...); err != nil {
+		return 0, err
+	}
+	return len(message), nil
+}
@@ -0,0 +1,76 @@
+package base
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	file, err := OpenRotatingFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatalf("open error: %s", err)
+	}
+	defer file.file.Close()
+	if _, err = file.Write([]byte("0123456789")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// renaming of removed file fails
+	os.Remove(path)
+	if _, err = file.Write([]byte("abc")); err == nil {
+		t.Error("expected rotation error")
+	}
+	if _, err = file.Write([]byte("d")); err != nil {
+		t.Errorf("unexpected error after failed rotation: %s", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "abcd" {
+		t.Errorf("expected entries written after failed rotation, got %q", content)
+	}
+}
+
+func TestNetworkWriteDeadline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %s", err)
+	}
+	defer listener.Close()
+	// server accepts connections, but never reads
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	connection := networkConnection{
+		Network: "tcp", Address: listener.Addr().String(),
+	}
+	defer func() {
+		if connection.conn != nil {
+			connection.conn.Close()
+		}
+	}()
+	message := bytes.Repeat([]byte("x"), 64*1024*1024)
+	start := time.Now()
+	if err = connection.write(message); err == nil {
+		t.Fatal("expected write timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 4*networkWriteTimeout {
+		t.Errorf("write blocked for %s", elapsed)
+	}
+	// server is not dialed again until retry time
+	start = time.Now()
+	if err = connection.write([]byte("x")); err == nil ||
+		time.Since(start) > networkWriteTimeout {
+		t.Errorf("expected failing fast, got %v", err)
+	}
+}
@@ -1,10 +1,23 @@
 package base
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// timestampKey is name of entry time field in all formats.
+const timestampKey = "timestamp"
+
 type ExtraFieldsHook struct {
 	logrus.Hook
 	AppName string
@@ -15,38 +28,268 @@ func (hook ExtraFieldsHook) Levels() []logrus.Level {
 }
 
 func (hook ExtraFieldsHook) Fire(entry *logrus.Entry) error {
-	entry.Data["timestamp"] = time.Now().Format(time.StampMilli)
+	entry.Time = entry.Time.UTC()
 	entry.Data["app_name"] = hook.AppName
+	if entry.Context != nil {
+		spanContext := trace.SpanContextFromContext(entry.Context)
+		if spanContext.IsValid() {
+			entry.Data["trace_id"] = spanContext.TraceID().String()
+			entry.Data["span_id"] = spanContext.SpanID().String()
+		}
+	}
+
+	return nil
+}
+
+// HumanFormatter writes entries as a line of time, level and message
+// followed by sorted fields, for reading logs in terminal.
+type HumanFormatter struct{}
+
+func (formatter HumanFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	var buffer bytes.Buffer
+	fmt.Fprintf(
+		&buffer,
+		"%s %-7s %s",
+		entry.Time.Format(time.RFC3339Nano),
+		strings.ToUpper(entry.Level.String()),
+		entry.Message,
+	)
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := fmt.Sprint(entry.Data[key])
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&buffer, " %s=%s", key, value)
+	}
+	buffer.WriteByte('\n')
+	return buffer.Bytes(), nil
+}
+
+// discardFormatter is used by logger itself, because entries are written
+// by sink hooks.
+type discardFormatter struct{}
+
+func (formatter discardFormatter) Format(*logrus.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// CreateFormatter returns formatter of "json", "logfmt" or "text" format.
+// Time is written in RFC 3339 format with nanoseconds.
+func CreateFormatter(format string) logrus.Formatter {
+	fieldMap := logrus.FieldMap{logrus.FieldKeyTime: timestampKey}
+	switch format {
+	case "logfmt":
+		return &logrus.TextFormatter{
+			DisableColors:   true,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339Nano,
+			FieldMap:        fieldMap,
+		}
+	case "text":
+		return HumanFormatter{}
+	}
+	return &logrus.JSONFormatter{
+		TimestampFormat: time.RFC3339Nano,
+		FieldMap:        fieldMap,
+	}
+}
+
+// SinkHook writes entries of its level and more severe ones to sink.
+// Level can be changed while logging.
+type SinkHook struct {
+	Name      string
+	Writer    io.Writer
+	Formatter logrus.Formatter
+	// Inherited is true, if sink has no own level and follows logs.level
+	Inherited bool
+	level     atomic.Uint32
+	mutex     sync.Mutex
+}
+
+func NewSinkHook(
+	name string, writer io.Writer, formatter logrus.Formatter,
+) *SinkHook {
+	return &SinkHook{Name: name, Writer: writer, Formatter: formatter}
+}
+
+func (hook *SinkHook) Level() logrus.Level {
+	return logrus.Level(hook.level.Load())
+}
 
+func (hook *SinkHook) SetLevel(level logrus.Level) {
+	hook.level.Store(uint32(level))
+}
+
+func (hook *SinkHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *SinkHook) Fire(entry *logrus.Entry) error {
+	if entry.Level > hook.Level() {
+		return nil
+	}
+	content, err := hook.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+	if _, err = hook.Writer.Write(content); err != nil {
+		return fmt.Errorf("log sink '%s' writing error. %s", hook.Name, err.Error())
+	}
 	return nil
 }
 
+func parseLogLevel(level string, fallback logrus.Level) logrus.Level {
+	if level == "" {
+		return fallback
+	}
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func createSinkHook(
+	config *LogConfig, sink *LogSinkConfig, level logrus.Level,
+) (*SinkHook, error) {
+	format := sink.Format
+	if format == "" {
+		format = config.Format
+	}
+	formatter := CreateFormatter(format)
+	hook, err := createSinkWriterHook(config, sink, formatter)
+	if err != nil {
+		return nil, err
+	}
+	hook.Inherited = sink.Level == ""
+	hook.SetLevel(parseLogLevel(sink.Level, level))
+	return hook, nil
+}
+
+func createSinkWriterHook(
+	config *LogConfig, sink *LogSinkConfig, formatter logrus.Formatter,
+) (*SinkHook, error) {
+	switch sink.Type {
+	case "file":
+		file, err := OpenRotatingFile(
+			sink.File, sink.MaxSize*1024*1024, sink.MaxAge, sink.MaxBackups,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return NewSinkHook(sink.File, file, formatter), nil
+	case "syslog":
+		facility, ok := syslogFacilities[sink.Facility]
+		if !ok {
+			facility = syslogFacilities["local0"]
+		}
+		return NewSinkHook(
+			sink.Address,
+			NewSyslogWriter(sink.Network, sink.Address),
+			&SyslogFormatter{
+				Formatter: formatter,
+				Facility:  facility,
+				AppName:   config.AppName,
+				Host:      Hostname(),
+			},
+		), nil
+	case "gelf":
+		if sink.Network == "unix" {
+			return nil, fmt.Errorf(
+				"log sink '%s' error, GELF supports udp and tcp networks",
+				sink.Address,
+			)
+		}
+		return NewSinkHook(
+			sink.Address,
+			NewGelfWriter(sink.Network, sink.Address),
+			&GelfFormatter{Host: Hostname()},
+		), nil
+	}
+	return NewSinkHook("stdout", os.Stdout, formatter), nil
+}
+
 var Logger = CreateLogger(nil)
 
 func CreateLogger(config *BackendConfig) *logrus.Logger {
 	var level logrus.Level
 	var hook ExtraFieldsHook
+	logConfig := &LogConfig{Format: "json"}
 	if config != nil {
-		var err error
-		level, err = logrus.ParseLevel(config.Logs.Level)
-		if err != nil {
-			panic(err)
-		}
+		level = parseLogLevel(config.Logs.Level, logrus.InfoLevel)
 		hook = ExtraFieldsHook{
 			AppName: config.Logs.AppName,
 		}
+		logConfig = &config.Logs
 	} else {
 		level = logrus.InfoLevel
 		hook = ExtraFieldsHook{
 			AppName: "stealthy-access-backend",
 		}
 	}
-	formatter := logrus.JSONFormatter{}
-	formatter.DisableTimestamp = true
 
+	sinks := logConfig.Sinks
+	if len(sinks) == 0 {
+		sinks = []LogSinkConfig{{Type: "stdout"}}
+	}
 	logger := logrus.New()
-	logger.SetFormatter(&formatter)
-	logger.SetLevel(level)
+	logger.SetOutput(io.Discard)
+	logger.SetFormatter(discardFormatter{})
 	logger.AddHook(&hook)
+	for i := range sinks {
+		sinkHook, err := createSinkHook(logConfig, &sinks[i], level)
+		if err != nil {
+			panic(err)
+		}
+		logger.AddHook(sinkHook)
+	}
+	SetLogLevel(logger, level)
 	return logger
 }
+
+func sinkHooks(logger *logrus.Logger) []*SinkHook {
+	var hooks []*SinkHook
+	for _, hook := range logger.Hooks[logrus.PanicLevel] {
+		if sinkHook, ok := hook.(*SinkHook); ok {
+			hooks = append(hooks, sinkHook)
+		}
+	}
+	return hooks
+}
+
+// LogLevel returns level of sinks, which follow logs.level.
+func LogLevel(logger *logrus.Logger) logrus.Level {
+	for _, hook := range sinkHooks(logger) {
+		if hook.Inherited {
+			return hook.Level()
+		}
+	}
+	return logger.GetLevel()
+}
+
+// SetLogLevel changes level of sinks, which follow logs.level, sinks with
+// own level keep it. Logger level is the most verbose level of sinks, so
+// entries are not created for nothing.
+func SetLogLevel(logger *logrus.Logger, level logrus.Level) {
+	loggerLevel := logrus.PanicLevel
+	hooks := sinkHooks(logger)
+	for _, hook := range hooks {
+		if hook.Inherited {
+			hook.SetLevel(level)
+		}
+		loggerLevel = max(loggerLevel, hook.Level())
+	}
+	if len(hooks) == 0 {
+		loggerLevel = level
+	}
+	logger.SetLevel(loggerLevel)
+}
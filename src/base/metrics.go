@@ -0,0 +1,108 @@
+package base
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const metricsNamespace string = "access_backend"
+
+// MetricsRegistry contains all service metrics together with Go runtime
+// and process metrics.
+var MetricsRegistry = prometheus.NewRegistry()
+
+var (
+	HttpRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route template, method and status.",
+		},
+		[]string{"route", "method", "status"},
+	)
+	HttpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route template, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"route", "method", "status"},
+	)
+	HttpRequestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests being served.",
+		},
+	)
+	KratosRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "kratos_requests_total",
+			Help:      "Number of Kratos admin API calls by operation and error class.",
+		},
+		[]string{"operation", "class"},
+	)
+	KratosRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "kratos_request_duration_seconds",
+			Help:      "Duration of Kratos admin API calls by operation.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+	WebhookDeliveriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "webhook_deliveries_total",
+			Help:      "Number of webhook delivery attempts by result.",
+		},
+		[]string{"result"},
+	)
+	WebhookDeliveryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "webhook_delivery_duration_seconds",
+			Help:      "Duration of webhook delivery attempts by result.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"result"},
+	)
+)
+
+// Results of webhook delivery attempt
+const (
+	WebhookDelivered  = "delivered"
+	WebhookRetried    = "retried"
+	WebhookDeadLetter = "dead_letter"
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HttpRequestsTotal,
+		HttpRequestDuration,
+		HttpRequestsInFlight,
+		KratosRequestsTotal,
+		KratosRequestDuration,
+		WebhookDeliveriesTotal,
+		WebhookDeliveryDuration,
+	)
+}
+
+// RegisterQueueDepth adds gauge of background queue depth, which is read
+// from depth function on every scrape.
+func RegisterQueueDepth(queue string, depth func() int64) {
+	MetricsRegistry.MustRegister(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace:   metricsNamespace,
+			Name:        "queue_depth",
+			Help:        "Number of items waiting in background queue.",
+			ConstLabels: prometheus.Labels{"queue": queue},
+		},
+		func() float64 { return float64(depth()) },
+	))
+}
@@ -0,0 +1,81 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer creates spans of service operations. It uses global tracer
+// provider, so spans are not recorded until tracing is enabled.
+var Tracer = otel.Tracer("access-backend")
+
+func createSpanExporter(config *TracingConfig) (sdktrace.SpanExporter, error) {
+	ctx := context.Background()
+	switch config.Exporter {
+	case "otlpgrpc":
+		options := []otlptracegrpc.Option{}
+		if config.Endpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, options...)
+	case "otlphttp":
+		options := []otlptracehttp.Option{}
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, options...)
+	default:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+}
+
+// CreateTracerProvider configures global OpenTelemetry tracer provider and
+// W3C trace context propagation. Provider must be shut down to flush spans.
+func CreateTracerProvider(config *TracingConfig) (*sdktrace.TracerProvider, error) {
+	exporter, err := createSpanExporter(config)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"tracing exporter '%s' creation error. %s", config.Exporter, err.Error(),
+		)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(config.SampleRatio),
+		)),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(config.ServiceName),
+			semconv.ServiceVersion(Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	return provider, nil
+}
+
+// TraceId returns id of trace of span in context or empty string.
+func TraceId(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -7,13 +7,23 @@ import (
 	"access-backend/base"
 	"access-backend/docs"
 	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	ory "github.com/ory/kratos-client-go"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // @title Stealthy Access Backend
@@ -53,10 +63,15 @@ func processPanic() {
 func configureSwagger(swaggerRouter *gin.RouterGroup, config *base.BackendConfig) {
 	base.Logger.Info("Configuring openapi")
 
-	baseUrl := config.Server.Socket + config.Server.BasePath
+	scheme := "http"
+	if config.Server.Tls.Enabled {
+		scheme = "https"
+	}
+	baseUrl := scheme + "://" + config.Server.Socket + config.Server.BasePath
 
 	docs.SwaggerInfo.Host = config.Server.Socket
 	docs.SwaggerInfo.BasePath = config.Server.BasePath
+	docs.SwaggerInfo.Schemes = []string{scheme}
 	docs.SwaggerInfo.Description = "Stealthy backend service. " +
 		"REST API web application. Encapsulates user's service " +
 		"business logic of Stealthy system." +
@@ -84,22 +99,282 @@ func setLogger(config *base.BackendConfig) {
 	base.Logger = base.CreateLogger(config)
 }
 
-func runServer(engine *gin.Engine, config *base.BackendConfig) {
-	base.Logger.Info("Starting server")
-	if err := engine.Run(config.Server.Socket); err != nil {
+// redirectToHttps returns handler, which redirects requests to the same
+// host and URI on HTTPS port of socket.
+func redirectToHttps(socket string) http.Handler {
+	_, port, _ := net.SplitHostPort(socket)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(
+			w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect,
+		)
+	})
+}
+
+// runServer serves requests until SIGTERM or SIGINT. After signal health
+// check reports "shutting down" for ShutdownDelay, then listener is closed
+// and in-flight requests are drained, then background workers are stopped.
+// Draining and stopping workers are limited by ShutdownTimeout each.
+func runServer(
+	engine *gin.Engine,
+	opsEngine *gin.Engine,
+	config *base.BackendConfig,
+	lifecycle *services.LifecycleService,
+) {
+	server := &http.Server{
+		Addr:    config.Server.Socket,
+		Handler: engine,
+	}
+	var opsServer *http.Server
+	if opsEngine != nil {
+		opsServer = &http.Server{
+			Addr:    config.Server.Ops.Socket,
+			Handler: opsEngine,
+		}
+	}
+	var redirectServer *http.Server
+	if config.Server.Tls.Enabled {
+		certificates, err := services.NewCertificateService(&config.Server.Tls)
+		if err != nil {
+			processError(err)
+		}
+		if server.TLSConfig, err = certificates.ServerTlsConfig(); err != nil {
+			processError(err)
+		}
+		lifecycle.Go("certificate watcher", certificates.Watch)
+		if config.Server.Tls.RedirectSocket != "" {
+			redirectServer = &http.Server{
+				Addr:    config.Server.Tls.RedirectSocket,
+				Handler: redirectToHttps(config.Server.Socket),
+			}
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	serverErrors := make(chan error, 3)
+	go func() {
+		base.Logger.WithFields(logrus.Fields{
+			"tls": config.Server.Tls.Enabled,
+		}).Info("Starting server")
+		if config.Server.Tls.Enabled {
+			serverErrors <- server.ListenAndServeTLS("", "")
+		} else {
+			serverErrors <- server.ListenAndServe()
+		}
+	}()
+	if redirectServer != nil {
+		go func() {
+			base.Logger.Info("Starting HTTPS redirect server")
+			serverErrors <- redirectServer.ListenAndServe()
+		}()
+	}
+	if opsServer != nil {
+		go func() {
+			base.Logger.WithFields(logrus.Fields{
+				"socket": config.Server.Ops.Socket,
+			}).Info("Starting operations server")
+			serverErrors <- opsServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serverErrors:
 		panic(err)
+	case received := <-signals:
+		base.Logger.WithFields(logrus.Fields{
+			"signal": received.String(),
+		}).Info("Shutting down server")
+	}
+
+	lifecycle.BeginShutdown()
+	time.Sleep(config.Server.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), config.Server.ShutdownTimeout,
+	)
+	defer cancel()
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		base.Logger.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("In-flight requests are not finished in time")
+	}
+
+	// Operations server is stopped last, so readiness is reported during
+	// draining
+	if opsServer != nil {
+		opsServer.Shutdown(ctx)
+	}
+
+	running := lifecycle.Stop(config.Server.ShutdownTimeout)
+	for _, name := range running {
+		base.Logger.WithFields(logrus.Fields{
+			"worker": name,
+		}).Error("Background worker is not stopped in time")
 	}
 	base.Logger.Info("Server stopped")
 }
 
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(
+		base.MetricsRegistry, promhttp.HandlerOpts{Registry: base.MetricsRegistry},
+	)
+}
+
+// createOpsRouter returns router of operational endpoints served on
+// separate listener without base path.
+func createOpsRouter(
+	config *base.BackendConfig, healthController controllers.HealthController,
+) *gin.Engine {
+	opsController := controllers.OpsController{
+		OpsConfig: &config.Server.Ops,
+		Health:    healthController,
+	}
+
+	router := gin.New()
+	router.NoRoute(api.NoRouteHandler)
+	router.NoMethod(api.NoMethodHandler)
+	router.Use(api.ErrorHandler)
+	router.Use(opsController.Authenticate)
+	if config.Server.Metrics.Enabled {
+		router.GET(config.Server.Metrics.Path, gin.WrapH(metricsHandler()))
+	}
+
+	router.GET("/health/live", opsController.Live)
+	router.GET("/health/ready", opsController.Ready)
+	router.GET("/debug/vars", opsController.Metrics)
+	router.GET("/build-info", opsController.BuildInfo)
+	if config.Server.Ops.Pprof {
+		router.GET(
+			fmt.Sprintf("/debug/pprof/*%s", base.ProfileNamePathParam),
+			opsController.Profile,
+		)
+	}
+	return router
+}
+
 func createKratosClient(config *base.BackendConfig) *ory.APIClient {
 	serverConfig := ory.NewConfiguration()
 	serverConfig.Servers = []ory.ServerConfiguration{
 		{URL: config.Kratos.AdminApiUrl},
 	}
+	var transport http.RoundTripper = &services.RequestIdTransport{}
+	if config.Server.Metrics.Enabled {
+		transport = &services.KratosMetricsTransport{Next: transport}
+	}
+	if config.Tracing.Enabled {
+		transport = otelhttp.NewTransport(transport)
+	}
+	serverConfig.HTTPClient = &http.Client{Transport: transport}
 	return ory.NewAPIClient(serverConfig)
 }
 
+func createLockoutService(
+	config *base.BackendConfig, ctx *context.Context,
+) *services.LockoutService {
+	var store services.AttemptsStore
+	if config.Auth.Lockout.Store == "redis" {
+		store = services.NewRedisAttemptsStore(config.Auth.Lockout.Redis, ctx)
+	} else {
+		store = services.NewMemoryAttemptsStore()
+	}
+	return &services.LockoutService{
+		LockoutConfig: &config.Auth.Lockout,
+		Store:         store,
+	}
+}
+
+func createAuditService(config *base.BackendConfig) *services.AuditService {
+	var sink services.AuditSink
+	var err error
+	if config.Audit.Sink == "postgres" {
+		sink, err = services.NewPostgresAuditSink(config.Audit.PostgresDsn)
+	} else {
+		sink, err = services.NewFileAuditSink(config.Audit.File)
+	}
+	if err != nil {
+		processError(err)
+	}
+	service := &services.AuditService{AuditConfig: &config.Audit, Sink: sink}
+	if config.Audit.CheckpointKey != "" {
+		service.CheckpointKey, err = services.ParseCheckpointKey(
+			config.Audit.CheckpointKey,
+		)
+		if err != nil {
+			processError(err)
+		}
+		service.VerifyKey = service.CheckpointKey.Public().(ed25519.PublicKey)
+	}
+	if config.Audit.CheckpointPublicKey != "" {
+		publicKey, err := services.ParseCheckpointPublicKey(
+			config.Audit.CheckpointPublicKey,
+		)
+		if err != nil {
+			processError(err)
+		}
+		if service.VerifyKey != nil && !publicKey.Equal(service.VerifyKey) {
+			processError(errors.New(
+				"audit checkpoint public key does not match checkpoint key",
+			))
+		}
+		service.VerifyKey = publicKey
+	}
+	return service
+}
+
+func createOutboxService(config *base.BackendConfig) *services.OutboxService {
+	var store services.OutboxStore
+	var err error
+	if config.Outbox.Store == "postgres" {
+		store, err = services.NewPostgresOutboxStore(config.Outbox.PostgresDsn)
+	} else {
+		store, err = services.NewFileOutboxStore(config.Outbox.File)
+	}
+	if err != nil {
+		processError(err)
+	}
+	broker, err := services.CreateBroker(&config.Outbox)
+	if err != nil {
+		processError(err)
+	}
+	return services.NewOutboxService(&config.Outbox, store, broker)
+}
+
+// verifyAudit implements 'audit verify' command, which walks audit events
+// chain and reports the first broken link.
+func verifyAudit(config *base.BackendConfig) {
+	service := createAuditService(config)
+	defer service.Sink.Close()
+
+	result, err := service.Verify()
+	if err != nil {
+		processError(err)
+	}
+	fields := logrus.Fields{
+		"legacy_events": result.Legacy,
+		"events":        result.Events,
+		"checkpoints":   result.Checkpoints,
+	}
+	if result.BrokenId != 0 {
+		fields["broken_id"] = result.BrokenId
+		fields["reason"] = result.Reason
+		base.Logger.WithFields(fields).Error("Audit chain is broken")
+		os.Exit(1)
+	}
+	base.Logger.WithFields(fields).Info("Audit chain verified")
+}
+
 func main() {
 	defer processPanic()
 
@@ -111,42 +386,399 @@ func main() {
 
 	setLogger(config)
 
+	if len(os.Args) > 2 && os.Args[1] == "audit" && os.Args[2] == "verify" {
+		verifyAudit(config)
+		return
+	}
+
+	if config.Tracing.Enabled {
+		provider, err := base.CreateTracerProvider(&config.Tracing)
+		if err != nil {
+			processError(err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(
+				context.Background(), config.Server.ShutdownTimeout,
+			)
+			defer cancel()
+			provider.Shutdown(ctx)
+		}()
+	}
+
 	client := createKratosClient(config)
-	contextObject := context.TODO()
+	lifecycle := services.NewLifecycleService()
+	contextObject := lifecycle.Context()
+	events := &services.EventDispatcher{}
+	healthService := services.NewHealthService(&config.Health, lifecycle)
+	healthService.AddCheck(
+		base.KratosHealthCheck, services.KratosReadyCheck(client),
+	)
+	healthService.AddCheck(
+		base.KratosSchemaHealthCheck, services.KratosSchemaCheck(client),
+	)
+
+	webhookService, err := services.NewWebhookService(&config.Webhooks)
+	if err != nil {
+		processError(err)
+	}
+	if config.Tracing.Enabled {
+		webhookService.Client.Transport = otelhttp.NewTransport(
+			http.DefaultTransport,
+		)
+	}
+	events.Subscribe(webhookService)
+	lifecycle.Go("webhooks", webhookService.Run)
+	base.RegisterQueueDepth("webhooks", webhookService.QueueDepth)
+
+	if config.Outbox.Enabled {
+		outboxService := createOutboxService(config)
+		defer outboxService.Store.Close()
+		events.Subscribe(outboxService)
+		healthService.AddCheck(base.OutboxHealthCheck, outboxService.Store.Ping)
+		lifecycle.Go("outbox", outboxService.Run)
+		base.RegisterQueueDepth("outbox", outboxService.QueueDepth)
+	}
+
+	var historyService *services.HistoryService
+	if config.History.Enabled {
+		historyService, err = services.NewHistoryService(
+			&config.History, &contextObject, client, events,
+		)
+		if err != nil {
+			processError(err)
+		}
+		defer historyService.Close()
+	}
+	historyController := controllers.HistoryController{Service: historyService}
+
+	if config.Reconciler.Enabled {
+		reconcilerService, err := services.NewReconcilerService(
+			&config.Reconciler, client, events,
+		)
+		if err != nil {
+			processError(err)
+		}
+		if historyService != nil {
+			reconcilerService.History = historyService
+		}
+		events.Subscribe(reconcilerService)
+		lifecycle.Go("reconciler", reconcilerService.Run)
+	}
+
+	streamService := services.NewEventStreamService(&config.Stream)
+	events.Subscribe(streamService)
+	streamController := controllers.EventStreamController{
+		Service:           streamService,
+		HeartbeatInterval: config.Stream.HeartbeatInterval,
+		Lifecycle:         lifecycle,
+	}
+	webhookController := controllers.WebhookController{
+		Service:         webhookService,
+		SchemaValidator: schemaValidator,
+	}
 
 	authController := controllers.AuthController{
 		AuthService: &services.AuthService{AuthConfig: &config.Auth},
+		SignatureService: &services.SignatureService{
+			AuthConfig: &config.Auth,
+			Nonces:     services.NewNonceCache(),
+		},
+	}
+	tokenController := controllers.TokenController{
+		SchemaValidator: schemaValidator,
+	}
+	if config.Auth.Exchange.Enabled {
+		revocations, err := services.NewRevocationList(
+			config.Auth.Exchange.RevocationFile,
+		)
+		if err != nil {
+			processError(err)
+		}
+		tokenService := &services.TokenService{
+			ExchangeConfig: &config.Auth.Exchange,
+			Revocations:    revocations,
+		}
+		authController.TokenService = tokenService
+		tokenController.Service = tokenService
+	}
+	if config.Auth.Lockout.Enabled {
+		lockoutService := createLockoutService(config, &contextObject)
+		authController.LockoutConfig = &config.Auth.Lockout
+		authController.LockoutService = lockoutService
+		healthService.AddCheck(base.LockoutHealthCheck, lockoutService.Store.Ping)
 	}
 	userController := controllers.UserController{
 		Service: &services.UserService{
 			Context:      &contextObject,
 			KratosClient: client,
+			Events:       events,
 		},
 		SchemaValidator: schemaValidator,
 	}
+	auditController := controllers.AuditController{
+		SchemaValidator:        schemaValidator,
+		PaginationDefaultLimit: config.Server.PaginationDefaultLimit,
+	}
+	kratosHookController := controllers.KratosHookController{
+		Service:         &services.KratosHookService{Events: events},
+		HooksConfig:     &config.Kratos.Hooks,
+		SchemaValidator: schemaValidator,
+	}
+	if config.Audit.Enabled {
+		auditService := createAuditService(config)
+		defer auditService.Sink.Close()
+		if err := auditService.StartChain(); err != nil {
+			processError(err)
+		}
+		healthService.AddCheck(base.AuditHealthCheck, auditService.Sink.Ping)
+		if auditService.CheckpointKey != nil {
+			lifecycle.Go("audit checkpoints", auditService.RunCheckpoints)
+		}
+		userController.AuditService = auditService
+		auditController.Service = auditService
+		kratosHookController.AuditService = auditService
+		historyController.AuditService = auditService
+	}
+	if historyService != nil {
+		userController.HistoryService = historyService
+		kratosHookController.HistoryService = historyService
+	}
+	deletionController := controllers.DeletionController{
+		AuditService: userController.AuditService,
+	}
+	if config.Deletion.Enabled {
+		deletionService, err := services.NewDeletionService(
+			lifecycle, &config.Deletion, userController.Service,
+		)
+		if err != nil {
+			processError(err)
+		}
+		if config.Tracing.Enabled {
+			deletionService.Client.Transport = otelhttp.NewTransport(
+				deletionService.Client.Transport,
+			)
+		}
+		deletionService.AuditService = userController.AuditService
+		deletionService.ResumeInterrupted()
+		userController.DeletionService = deletionService
+		deletionController.Service = deletionService
+	}
+	logLevelService := &services.LogLevelService{
+		LogConfig:    &config.Logs,
+		Logger:       base.Logger,
+		AuditService: userController.AuditService,
+	}
+	lifecycle.Go("log level watcher", logLevelService.Watch)
+	logLevelController := controllers.LogLevelController{
+		Service:         logLevelService,
+		SchemaValidator: schemaValidator,
+	}
+	policyService := &services.PolicyService{PolicyConfig: &config.Policy}
+	policyController := controllers.PolicyController{
+		Service:         policyService,
+		UserService:     userController.Service,
+		SchemaValidator: schemaValidator,
+		BasePath:        config.Server.BasePath,
+	}
+	if config.Policy.Enabled {
+		if err = policyService.Load(); err != nil {
+			processError(err)
+		}
+		lifecycle.Go("policy watcher", policyService.Watch)
+	}
 
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	if err = router.SetTrustedProxies(config.Server.TrustedProxies); err != nil {
+		processError(err)
+	}
 	router.NoRoute(api.NoRouteHandler)
 	router.NoMethod(api.NoMethodHandler)
-	router.Use(api.LogsHandler)
+	if config.Tracing.Enabled {
+		router.Use(otelgin.Middleware(config.Tracing.ServiceName))
+	}
+	router.Use(api.RequestIdHandler)
+	if config.Server.Metrics.Enabled {
+		router.Use(api.MetricsHandler)
+	}
+	router.Use(api.LogsHandler(&config.Logs.Access))
 	router.Use(api.ErrorHandler)
 	router.Use(api.CORSHandler)
-
 	applicationGroup := router.Group(config.Server.BasePath)
 	v1 := applicationGroup.Group("/v1")
 
-	v1.GET("/health", controllers.CheckHealth)
+	healthController := controllers.HealthController{
+		Lifecycle: lifecycle,
+		Service:   healthService,
+	}
+	v1.GET("/health", healthController.CheckHealth)
+	v1.GET("/health/live", healthController.Live)
+	v1.GET("/health/ready", healthController.Ready)
+	if !config.Server.Ops.Enabled {
+		// Operations token protects metrics and readiness details like on
+		// operations listener
+		opsController := controllers.OpsController{
+			OpsConfig: &config.Server.Ops,
+			Health:    healthController,
+		}
+		opsGroup := router.Group("", opsController.Authenticate)
+		if config.Server.Metrics.Enabled {
+			opsGroup.GET(config.Server.Metrics.Path, gin.WrapH(metricsHandler()))
+		}
+		opsGroup.GET("/health/ready", opsController.Ready)
+	}
 
+	userPath := fmt.Sprintf("/:%s", base.UserIdPathParam)
+	// Policies are enforced on every authorized route after permission
+	// check, so callers without permission do not trigger target loading and
+	// rules evaluation. Empty permission means that any caller is allowed
+	authorizedHandlers := func(
+		permission base.Permission, handler gin.HandlerFunc,
+	) []gin.HandlerFunc {
+		var handlers []gin.HandlerFunc
+		if permission != "" {
+			handlers = append(handlers, api.PermissionHandler(permission))
+		}
+		if config.Policy.Enabled {
+			handlers = append(handlers, policyController.Enforce)
+		}
+		return append(handlers, handler)
+	}
 	usersGroup := v1.Group("/users").Use(authController.Authorize)
-	usersGroup.POST("", userController.AddUser)
-	usersGroup.GET("", userController.GetUsers)
+	usersGroup.POST(
+		"",
+		authorizedHandlers(base.CreateUsersPermission, userController.AddUser)...,
+	)
+	usersGroup.GET(
+		"",
+		authorizedHandlers(base.ReadUsersPermission, userController.GetUsers)...,
+	)
+	usersGroup.DELETE(
+		userPath,
+		authorizedHandlers(base.DeleteUsersPermission, userController.DeleteUser)...,
+	)
+	usersGroup.POST(
+		userPath+"/deactivate",
+		authorizedHandlers(base.DeactivateUsersPermission, userController.DeactivateUser)...,
+	)
+	usersGroup.POST(
+		userPath+"/activate",
+		authorizedHandlers(base.DeactivateUsersPermission, userController.ActivateUser)...,
+	)
 	usersGroup.DELETE(
-		fmt.Sprintf("/:%s", base.UserIdPathParam),
-		userController.DeleteUser,
+		userPath+"/sessions",
+		authorizedHandlers(base.DeactivateUsersPermission, userController.RevokeSessions)...,
+	)
+	if historyService != nil {
+		usersGroup.GET(
+			userPath+"/history",
+			authorizedHandlers(base.ReadUsersPermission, historyController.GetUserHistory)...,
+		)
+		usersGroup.POST(
+			userPath+fmt.Sprintf("/history/:%s/restore", base.VersionPathParam),
+			authorizedHandlers(base.UpdateUsersPermission, historyController.RestoreUserVersion)...,
+		)
+	}
+	if config.Deletion.Enabled {
+		usersGroup.GET(
+			userPath+"/deletion",
+			authorizedHandlers(base.ReadUsersPermission, deletionController.GetDeletion)...,
+		)
+		usersGroup.POST(
+			userPath+"/deletion/resume",
+			authorizedHandlers(base.DeleteUsersPermission, deletionController.ResumeDeletion)...,
+		)
+		usersGroup.POST(
+			userPath+"/deletion/force",
+			authorizedHandlers(base.DeleteUsersPermission, deletionController.ForceDeletion)...,
+		)
+	}
+
+	eventsGroup := v1.Group("/events").Use(authController.Authorize)
+	eventsGroup.GET(
+		"/stream",
+		authorizedHandlers(base.ReadUsersPermission, streamController.StreamEvents)...,
+	)
+
+	authzGroup := v1.Group("/authz").Use(authController.Authorize)
+	authzGroup.POST(
+		"/evaluate",
+		authorizedHandlers(base.EvaluatePolicyPermission, policyController.EvaluatePolicy)...,
 	)
 
+	webhooksGroup := v1.Group("/webhooks").Use(authController.Authorize)
+	webhooksGroup.GET(
+		"",
+		authorizedHandlers(base.ManageWebhooksPermission, webhookController.GetWebhooks)...,
+	)
+	webhooksGroup.POST(
+		"",
+		authorizedHandlers(base.ManageWebhooksPermission, webhookController.AddWebhook)...,
+	)
+	webhooksGroup.DELETE(
+		fmt.Sprintf("/:%s", base.WebhookIdPathParam),
+		authorizedHandlers(base.ManageWebhooksPermission, webhookController.DeleteWebhook)...,
+	)
+	webhooksGroup.GET(
+		"/dead-letters",
+		authorizedHandlers(base.ManageWebhooksPermission, webhookController.GetDeadLetters)...,
+	)
+	webhooksGroup.POST(
+		fmt.Sprintf("/dead-letters/:%s/redeliver", base.DeliveryIdPathParam),
+		authorizedHandlers(base.ManageWebhooksPermission, webhookController.Redeliver)...,
+	)
+	webhooksGroup.GET(
+		"/stats",
+		authorizedHandlers(base.ManageWebhooksPermission, webhookController.GetWebhookStats)...,
+	)
+
+	adminGroup := v1.Group("/admin").Use(authController.Authorize)
+	adminGroup.GET(
+		"/log-level",
+		authorizedHandlers(base.ManageLogsPermission, logLevelController.GetLogLevel)...,
+	)
+	adminGroup.PUT(
+		"/log-level",
+		authorizedHandlers(base.ManageLogsPermission, logLevelController.SetLogLevel)...,
+	)
+
+	if config.Audit.Enabled {
+		auditGroup := v1.Group("/audit").Use(authController.Authorize)
+		auditGroup.GET(
+			"",
+			authorizedHandlers(base.ReadAuditPermission, auditController.GetAuditEvents)...,
+		)
+	}
+
+	if config.Kratos.Hooks.Enabled {
+		hooksGroup := v1.Group("/hooks/kratos").Use(
+			kratosHookController.Authenticate,
+		)
+		hooksGroup.POST(
+			fmt.Sprintf("/:%s", base.KratosFlowPathParam),
+			kratosHookController.HandleHook,
+		)
+		hooksGroup.POST(
+			fmt.Sprintf("/:%s/validate", base.KratosFlowPathParam),
+			kratosHookController.ValidateHook,
+		)
+	}
+
+	if config.Auth.Exchange.Enabled {
+		authGroup := v1.Group("/auth").Use(authController.Authorize)
+		authGroup.POST("/token", authorizedHandlers("", tokenController.IssueToken)...)
+		authGroup.POST(
+			"/token/revoke",
+			authorizedHandlers(base.ManageKeysPermission, tokenController.RevokeToken)...,
+		)
+	}
+
 	configureSwagger(applicationGroup, config)
 
-	runServer(router, config)
+	var opsRouter *gin.Engine
+	if config.Server.Ops.Enabled {
+		opsRouter = createOpsRouter(config, healthController)
+	}
+
+	runServer(router, opsRouter, config, lifecycle)
 }
@@ -0,0 +1,139 @@
+// Package signing implements HMAC-SHA256 request signing scheme accepted by
+// access backend as an alternative to bearer tokens. Signature covers
+// request method, path, query, body digest, timestamp and nonce, so signed
+// request can not be modified or replayed by intermediate proxies.
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Scheme string = "HMAC-SHA256"
+const TimestampHeader string = "X-Signature-Timestamp"
+const NonceHeader string = "X-Signature-Nonce"
+
+const keyIdParam string = "keyId"
+const signatureParam string = "signature"
+
+func BodyDigest(body []byte) string {
+	digest := sha256.Sum256(body)
+	return hex.EncodeToString(digest[:])
+}
+
+func StringToSign(
+	method string,
+	path string,
+	query string,
+	bodyDigest string,
+	timestamp string,
+	nonce string,
+) string {
+	return strings.Join(
+		[]string{
+			strings.ToUpper(method), path, query, bodyDigest, timestamp, nonce,
+		},
+		"\n",
+	)
+}
+
+func ComputeSignature(secret string, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func FormatAuthorization(keyId string, signature string) string {
+	return Scheme + " " + keyIdParam + "=" + keyId + "," +
+		signatureParam + "=" + signature
+}
+
+// ParseAuthorization extracts key id and signature from Authorization
+// header value of HMAC-SHA256 scheme.
+func ParseAuthorization(header string) (string, string, error) {
+	params, found := strings.CutPrefix(header, Scheme+" ")
+	if !found {
+		return "", "", errors.New("authorization scheme is not " + Scheme)
+	}
+
+	var keyId, signature string
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case keyIdParam:
+			keyId = value
+		case signatureParam:
+			signature = value
+		}
+	}
+	if keyId == "" || signature == "" {
+		return "", "", errors.New(
+			"authorization requires '" + keyIdParam + "' and '" +
+				signatureParam + "' params",
+		)
+	}
+	return keyId, signature, nil
+}
+
+// RequestStringToSign reads request body and builds string to sign from
+// request data. Body is restored, so request can still be sent or handled.
+func RequestStringToSign(request *http.Request) (string, error) {
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = io.ReadAll(request.Body)
+		if err != nil {
+			return "", err
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return StringToSign(
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.Query().Encode(),
+		BodyDigest(body),
+		request.Header.Get(TimestampHeader),
+		request.Header.Get(NonceHeader),
+	), nil
+}
+
+func newNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// SignRequest sets timestamp, nonce and Authorization headers of request
+// signed with given key.
+func SignRequest(request *http.Request, keyId string, secret string) error {
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	request.Header.Set(
+		TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10),
+	)
+	request.Header.Set(NonceHeader, nonce)
+
+	stringToSign, err := RequestStringToSign(request)
+	if err != nil {
+		return err
+	}
+	request.Header.Set(
+		"Authorization",
+		FormatAuthorization(keyId, ComputeSignature(secret, stringToSign)),
+	)
+	return nil
+}
@@ -0,0 +1,195 @@
+package signing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// emptyBodyDigest is SHA-256 of empty body.
+const emptyBodyDigest = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func TestStringToSign(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		query      string
+		bodyDigest string
+		timestamp  string
+		nonce      string
+		expected   string
+	}{
+		{
+			name:       "all parts",
+			method:     "POST",
+			path:       "/backend/v1/users",
+			query:      "limit=10",
+			bodyDigest: "digest",
+			timestamp:  "1700000000",
+			nonce:      "nonce",
+			expected:   "POST\n/backend/v1/users\nlimit=10\ndigest\n1700000000\nnonce",
+		},
+		{
+			name:       "method is upper cased",
+			method:     "get",
+			path:       "/backend/v1/users",
+			bodyDigest: emptyBodyDigest,
+			timestamp:  "1700000000",
+			nonce:      "nonce",
+			expected: "GET\n/backend/v1/users\n\n" + emptyBodyDigest +
+				"\n1700000000\nnonce",
+		},
+		{
+			name:     "missing parts stay empty lines",
+			method:   "DELETE",
+			path:     "/backend/v1/users/42",
+			expected: "DELETE\n/backend/v1/users/42\n\n\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := StringToSign(
+				test.method,
+				test.path,
+				test.query,
+				test.bodyDigest,
+				test.timestamp,
+				test.nonce,
+			)
+			if actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRequestStringToSign(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		headers  map[string]string
+		expected string
+	}{
+		{
+			name:   "request with body",
+			method: http.MethodPost,
+			target: "/backend/v1/users",
+			body:   `{"username":"john"}`,
+			headers: map[string]string{
+				TimestampHeader: "1700000000",
+				NonceHeader:     "abc",
+			},
+			expected: "POST\n/backend/v1/users\n\n" +
+				BodyDigest([]byte(`{"username":"john"}`)) + "\n1700000000\nabc",
+		},
+		{
+			name:   "query is sorted and path is escaped",
+			method: http.MethodGet,
+			target: "/backend/v1/users/a%20b?b=2&a=1",
+			headers: map[string]string{
+				TimestampHeader: "1700000000",
+				NonceHeader:     "abc",
+			},
+			expected: "GET\n/backend/v1/users/a%20b\na=1&b=2\n" +
+				emptyBodyDigest + "\n1700000000\nabc",
+		},
+		{
+			name:     "missing headers",
+			method:   http.MethodGet,
+			target:   "/backend/v1/users",
+			expected: "GET\n/backend/v1/users\n\n" + emptyBodyDigest + "\n\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(
+				test.method, test.target, strings.NewReader(test.body),
+			)
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+
+			actual, err := RequestStringToSign(request)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if actual != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, actual)
+			}
+			body, _ := io.ReadAll(request.Body)
+			if string(body) != test.body {
+				t.Errorf("body is not restored, got %q", body)
+			}
+		})
+	}
+}
+
+func TestParseAuthorization(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		keyId     string
+		signature string
+		valid     bool
+	}{
+		{
+			name:      "valid",
+			header:    FormatAuthorization("ci", "abcdef"),
+			keyId:     "ci",
+			signature: "abcdef",
+			valid:     true,
+		},
+		{
+			name:      "params with spaces",
+			header:    Scheme + " keyId=ci, signature=abcdef",
+			keyId:     "ci",
+			signature: "abcdef",
+			valid:     true,
+		},
+		{name: "bearer scheme", header: "Bearer token"},
+		{name: "missing signature", header: Scheme + " keyId=ci"},
+		{name: "missing key id", header: Scheme + " signature=abcdef"},
+		{name: "empty", header: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keyId, signature, err := ParseAuthorization(test.header)
+			if test.valid != (err == nil) {
+				t.Fatalf("expected valid %t, got error %v", test.valid, err)
+			}
+			if keyId != test.keyId || signature != test.signature {
+				t.Errorf(
+					"expected %q and %q, got %q and %q",
+					test.keyId, test.signature, keyId, signature,
+				)
+			}
+		})
+	}
+}
+
+func TestComputeSignature(t *testing.T) {
+	stringToSign := StringToSign(
+		"GET", "/", "", emptyBodyDigest, "1700000000", "nonce",
+	)
+	signature := ComputeSignature("secret", stringToSign)
+	if signature != ComputeSignature("secret", stringToSign) {
+		t.Error("signature is not deterministic")
+	}
+	if signature == ComputeSignature("other secret", stringToSign) {
+		t.Error("signature does not depend on secret")
+	}
+	if signature == ComputeSignature("secret", stringToSign+"x") {
+		t.Error("signature does not depend on string to sign")
+	}
+	if len(signature) != 64 {
+		t.Errorf("expected hex SHA-256 signature, got %q", signature)
+	}
+}